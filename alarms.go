@@ -0,0 +1,198 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const defaultAlarmsFile = "/etc/goes/vnet-alarms.yaml"
+
+// Threshold on a translated counter name (see xCounter), e.g.
+//
+//	rx-crc-errors: {rate: 10, hysteresis: 2}
+//	mmu-rx-threshold-drop-packets: {absolute: 1000}
+//
+// An alarm raises when the per second rate or the value since the last
+// "clear counters" reaches the threshold and clears when it falls below
+// threshold - hysteresis.
+type alarmRule struct {
+	Rate       float64 `yaml:"rate,omitempty"`
+	Absolute   float64 `yaml:"absolute,omitempty"`
+	Hysteresis float64 `yaml:"hysteresis,omitempty"`
+}
+
+func (r *alarmRule) String() string {
+	return fmt.Sprintf("{rate: %g, absolute: %g, hysteresis: %g}",
+		r.Rate, r.Absolute, r.Hysteresis)
+}
+
+func (r *alarmRule) validate() error {
+	if (r.Rate == 0) == (r.Absolute == 0) {
+		return fmt.Errorf("alarm needs one of rate or absolute")
+	}
+	if r.Rate < 0 || r.Absolute < 0 || r.Hysteresis < 0 {
+		return fmt.Errorf("alarm thresholds must be positive")
+	}
+	return nil
+}
+
+// Returns the value compared against the threshold.
+func (r *alarmRule) level(c ifCounter, value uint64) (level, threshold float64) {
+	if r.Rate != 0 {
+		return c.rate, r.Rate
+	}
+	return float64(value), r.Absolute
+}
+
+type alarmRules map[string]*alarmRule
+
+// Replace all rules with those of the YAML file.
+func (p *ifStatsPoller) loadAlarms(filename string) error {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	rules := make(alarmRules)
+	if err = yaml.Unmarshal(b, &rules); err != nil {
+		return err
+	}
+	for counter, r := range rules {
+		if err = r.validate(); err != nil {
+			return fmt.Errorf("%s: %s: %v", filename, counter, err)
+		}
+	}
+	old := p.alarmRules
+	p.alarmRules = rules
+	for counter := range old {
+		if _, found := rules[counter]; !found {
+			p.pubq.send(fmt.Sprint("alarm-rule.", counter, ": none"))
+		}
+	}
+	p.pubAlarmRules()
+	p.clearOrphanAlarms(old, time.Now())
+	return nil
+}
+
+// Set, or with "none" delete, a rule from a YAML flow map like
+// "{rate: 10, hysteresis: 2}".
+func (p *ifStatsPoller) setAlarm(counter, value string) (string, error) {
+	if p.alarmRules == nil {
+		p.alarmRules = make(alarmRules)
+	}
+	if value == "none" {
+		old := alarmRules{counter: p.alarmRules[counter]}
+		delete(p.alarmRules, counter)
+		p.clearOrphanAlarms(old, time.Now())
+		return value, nil
+	}
+	r := new(alarmRule)
+	if err := yaml.UnmarshalStrict([]byte(value), r); err != nil {
+		return "", err
+	}
+	if err := r.validate(); err != nil {
+		return "", err
+	}
+	p.alarmRules[counter] = r
+	return r.String(), nil
+}
+
+func (p *ifStatsPoller) pubAlarmRules() {
+	counters := make([]string, 0, len(p.alarmRules))
+	for counter := range p.alarmRules {
+		counters = append(counters, counter)
+	}
+	sort.Strings(counters)
+	for _, counter := range counters {
+		p.pubq.send(fmt.Sprint("alarm-rule.", counter, ": ",
+			p.alarmRules[counter]))
+	}
+}
+
+// Evaluate the rule, if any, of a counter just polled and publish
+// vnet.alarm.IF.COUNTER on raise or clear.
+func (p *ifStatsPoller) checkAlarm(psi *ifStatsPollerInterface,
+	counter string, t time.Time) {
+	name := xCounter(counter)
+	r, found := p.alarmRules[name]
+	if !found {
+		if psi.alarms != nil {
+			delete(psi.alarms, name)
+		}
+		return
+	}
+	c := psi.lastValues[counter]
+	level, threshold := r.level(c, psi.relative(counter, c.value))
+	raised := psi.alarms[name]
+	switch {
+	case !raised && level >= threshold:
+		raised = true
+	case raised && level < threshold-r.Hysteresis:
+		raised = false
+	default:
+		return
+	}
+	if psi.alarms == nil {
+		psi.alarms = make(map[string]bool)
+	}
+	psi.alarms[name] = raised
+	p.pubAlarm(psi, name, raised, t, level)
+}
+
+func (p *ifStatsPoller) pubAlarm(psi *ifStatsPollerInterface, name string,
+	raised bool, t time.Time, level float64) {
+	state := "clear"
+	if raised {
+		state = "raise"
+	}
+	p.pubq.send(fmt.Sprintf("alarm.%s.%s: %s %s %g", psi.name, name, state,
+		t.Format(time.RFC3339Nano), level))
+}
+
+// Clear the raised alarms of rules no longer in effect; old has the
+// rules in effect when they were raised.
+func (p *ifStatsPoller) clearOrphanAlarms(old alarmRules, t time.Time) {
+	for _, ifs := range []ifStatsPollerInterfaceVec{
+		p.hwInterfaces,
+		p.swInterfaces,
+	} {
+		for i := range ifs {
+			psi := &ifs[i]
+			for name, raised := range psi.alarms {
+				if _, found := p.alarmRules[name]; found {
+					continue
+				}
+				delete(psi.alarms, name)
+				if !raised {
+					continue
+				}
+				var level float64
+				for counter, c := range psi.lastValues {
+					r := old[name]
+					if r != nil && xCounter(counter) == name {
+						level, _ = r.level(c,
+							psi.relative(counter, c.value))
+					}
+				}
+				p.pubAlarm(psi, name, false, t, level)
+			}
+		}
+	}
+}
+
+// Load the default rules, if present.
+func (p *ifStatsPoller) initAlarms() {
+	if _, err := os.Stat(defaultAlarmsFile); err == nil {
+		if err = p.loadAlarms(defaultAlarmsFile); err != nil {
+			dbgVnetd.Log(err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetAlarm(t *testing.T) {
+	for _, x := range []struct {
+		value, out string
+		ok         bool
+	}{
+		{"{rate: 10, hysteresis: 2}",
+			"{rate: 10, absolute: 0, hysteresis: 2}", true},
+		{"{absolute: 1000}", "{rate: 0, absolute: 1000, hysteresis: 0}",
+			true},
+		{"none", "none", true},
+		{"{rate: 10, absolute: 5}", "", false},
+		{"{hysteresis: 1}", "", false},
+		{"{rate: -1}", "", false},
+		{"{rat: 10}", "", false},
+		{"10", "", false},
+	} {
+		p := &ifStatsPoller{}
+		p.pubq.init(16)
+		out, err := p.setAlarm("rx-crc-errors", x.value)
+		if (err == nil) != x.ok || out != x.out {
+			t.Errorf("setAlarm(%q) = %q, %v; want %q", x.value, out,
+				err, x.out)
+		}
+		if _, found := p.alarmRules["rx-crc-errors"]; found !=
+			(x.ok && x.value != "none") {
+			t.Errorf("setAlarm(%q) rule found %v", x.value, found)
+		}
+	}
+}
+
+func TestLoadAlarms(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alarms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, x := range []struct {
+		yaml  string
+		rules int
+		ok    bool
+	}{
+		{"rx-crc-errors: {rate: 10, hysteresis: 2}\n" +
+			"rx-packets: {absolute: 1000}\n", 2, true},
+		{"rx-crc-errors: {rate: 10, absolute: 1}\n", 0, false},
+		{"rx-crc-errors: [10]\n", 0, false},
+	} {
+		fn := filepath.Join(dir, "alarms.yaml")
+		if err = ioutil.WriteFile(fn, []byte(x.yaml), 0644); err != nil {
+			t.Fatal(err)
+		}
+		p := &ifStatsPoller{}
+		p.pubq.init(16)
+		err = p.loadAlarms(fn)
+		if (err == nil) != x.ok || len(p.alarmRules) != x.rules {
+			t.Errorf("%q: %v, %d rules", x.yaml, err, len(p.alarmRules))
+		}
+	}
+}
+
+func TestRemovedAlarmClears(t *testing.T) {
+	p := &ifStatsPoller{}
+	p.pubq.init(16)
+	p.setAlarm("rx-packets", "{absolute: 5}")
+	p.hwInterfaces.Validate(0)
+	psi := &p.hwInterfaces[0]
+	psi.name = "xeth1"
+	now := time.Now()
+	psi.update("port-rx-packets", 10, now)
+	p.checkAlarm(psi, "port-rx-packets", now)
+	<-p.pubq.ch
+	if _, err := p.setAlarm("rx-packets", "none"); err != nil {
+		t.Fatal(err)
+	}
+	if len(psi.alarms) != 0 {
+		t.Errorf("alarms %v after removal", psi.alarms)
+	}
+	select {
+	case s := <-p.pubq.ch:
+		if !strings.HasPrefix(s, "alarm.xeth1.rx-packets: clear ") ||
+			!strings.HasSuffix(s, " 10") {
+			t.Errorf("published %q", s)
+		}
+	default:
+		t.Error("no clear published")
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/xeth"
+)
+
+// Speeds that a port may advertise and the ethtool link mode of each.
+var adSpeeds = []struct {
+	bw   vnet.Bandwidth
+	mode uint
+}{
+	{1e9, xeth.ETHTOOL_LINK_MODE_1000baseKX_Full},
+	{10e9, xeth.ETHTOOL_LINK_MODE_10000baseKR_Full},
+	{20e9, xeth.ETHTOOL_LINK_MODE_20000baseKR2_Full},
+	{25e9, xeth.ETHTOOL_LINK_MODE_25000baseCR_Full},
+	{40e9, xeth.ETHTOOL_LINK_MODE_40000baseCR4_Full},
+	{50e9, xeth.ETHTOOL_LINK_MODE_50000baseCR2_Full},
+	{100e9, xeth.ETHTOOL_LINK_MODE_100000baseCR4_Full},
+}
+
+// Bitmask of adSpeeds advertised by an autoneg port; zero for all.
+// Neither vnet nor the fe1 driver can program advertised modes into the
+// MAC, so this is only checked against the negotiated speed.
+type advertisement uint8
+
+// Parse "all" or comma separated speeds, e.g. "100g,40g"; 1g is also
+// "1000m" as vnet formats it.
+func parseAdvertisement(s string) (advertisement, error) {
+	var ad advertisement
+	if s == "all" {
+		return ad, nil
+	}
+	for _, name := range strings.Split(s, ",") {
+		found := false
+		for i, x := range adSpeeds {
+			if name == x.bw.String() ||
+				name == fmt.Sprintf("%gg", x.bw/1e9) {
+				ad |= 1 << uint(i)
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("%s: unsupported speed", name)
+		}
+	}
+	return ad, nil
+}
+
+func (ad advertisement) String() string {
+	if ad == 0 {
+		return "all"
+	}
+	var names []string
+	for i, x := range adSpeeds {
+		if ad&(1<<uint(i)) != 0 {
+			names = append(names, x.bw.String())
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+func (ad advertisement) has(bw vnet.Bandwidth) bool {
+	for i, x := range adSpeeds {
+		if x.bw == bw {
+			return ad == 0 || ad&(1<<uint(i)) != 0
+		}
+	}
+	return false
+}
+
+func (ad advertisement) fastest() (bw vnet.Bandwidth) {
+	for i, x := range adSpeeds {
+		if ad == 0 || ad&(1<<uint(i)) != 0 {
+			bw = x.bw
+		}
+	}
+	return
+}
+
+// xeth's EthtoolLinkModeBits Test doesn't reduce the bit modulo 32.
+func testLinkMode(bits *xeth.EthtoolLinkModeBits, mode uint) bool {
+	return bits[mode/32]&(1<<(mode%32)) != 0
+}
+
+// Advertisement of link partner modes; all is distinguished from none.
+func linkModesAdvertisement(bits *xeth.EthtoolLinkModeBits) (ad advertisement, found bool) {
+	for i, x := range adSpeeds {
+		if testLinkMode(bits, x.mode) {
+			ad |= 1 << uint(i)
+			found = true
+		}
+	}
+	return
+}
+
+// Autoneg is vnet speed 0; disabling it restores the last fixed speed,
+// else that of ethtool, else the fastest advertised.
+func (mk1 *Mk1) setAutoneg(hi vnet.Hi, enable bool) (err error) {
+	v := &mk1.vnet
+	h := v.HwIf(hi)
+	c := mk1.hwIfConfig(hi.Name(v))
+	if enable == (h.Speed() == 0) {
+		return
+	}
+	if enable {
+		c.fixedSpeed = h.Speed()
+		err = hi.SetSpeed(v, 0)
+	} else {
+		bw := c.fixedSpeed
+		if entry, found := vnet.Ports.GetPortByName(hi.Name(v)); found &&
+			bw == 0 {
+			bw = vnet.Bandwidth(entry.Speed) * 1e6
+		}
+		if bw == 0 {
+			bw = c.advertise.fastest()
+		}
+		err = hi.SetSpeed(v, bw)
+	}
+	if err == nil {
+		mk1.portAutoneg(hi)
+	}
+	return
+}
+
+func (mk1 *Mk1) setAdvertise(hi vnet.Hi, s string) error {
+	ad, err := parseAdvertisement(s)
+	if err != nil {
+		return err
+	}
+	mk1.hwIfConfig(hi.Name(&mk1.vnet)).advertise = ad
+	mk1.pubAutoneg(hi)
+	return nil
+}
+
+// Keep the port entry's autoneg for re-provisioning. xeth has no
+// message to set ethtool autoneg or advertising in the kernel; ethtool
+// only sees the negotiated speed, sent with syncSpeed.
+func (mk1 *Mk1) portAutoneg(hi vnet.Hi) {
+	v := &mk1.vnet
+	autoneg := uint8(xeth.AUTONEG_DISABLE)
+	if v.HwIf(hi).Speed() == 0 {
+		autoneg = xeth.AUTONEG_ENABLE
+	}
+	if entry, found := vnet.Ports.GetPortByName(hi.Name(v)); found {
+		entry.Autoneg = autoneg
+	}
+}
+
+// Publish the negotiated speed and link partner modes of an autoneg port
+// with link, e.g.
+//
+//	xeth1.autoneg.speed: 100g
+//	xeth1.autoneg.partner: 40g,100g
+//
+// A speed outside of IF.advertise is qualified "(not advertised)".
+func (mk1 *Mk1) pubAutoneg(hi vnet.Hi) {
+	v := &mk1.vnet
+	h := v.HwIf(hi)
+	ifname := hi.Name(v)
+	c := mk1.hwIfConfig(ifname)
+	speed, partner := "none", "none"
+	if h.Speed() == 0 && h.IsLinkUp() {
+		bw := v.HwIfer(hi).GetHwInterfaceFinalSpeed()
+		speed = bw.String()
+		if !c.advertise.has(bw) {
+			speed += " (not advertised)"
+		}
+		if xethif := xeth.Interface.Named(ifname); xethif != nil {
+			bits := xeth.EthtoolLinkModeBits(xethif.EthtoolSettings.Partner)
+			if ad, found := linkModesAdvertisement(&bits); found {
+				partner = ad.String()
+			}
+		}
+	}
+	if speed != c.autonegSpeed {
+		c.autonegSpeed = speed
+		mk1.poller.pubq.send(fmt.Sprint(ifname, ".autoneg.speed: ", speed))
+	}
+	if partner != c.autonegPartner {
+		c.autonegPartner = partner
+		mk1.poller.pubq.send(fmt.Sprint(ifname, ".autoneg.partner: ",
+			partner))
+	}
+}
+
+// Send the negotiated speed of a port with link to the driver so that
+// ethtool can see it.
+func (mk1 *Mk1) syncSpeed(hi vnet.Hi) {
+	v := &mk1.vnet
+	if !v.HwIf(hi).IsLinkUp() {
+		return
+	}
+	xethif := xeth.Interface.Named(hi.Name(v))
+	if xethif == nil {
+		return
+	}
+	sp := v.HwIfer(hi).GetHwInterfaceFinalSpeed()
+	xeth.Speed(int(xethif.Ifinfo.Index), uint64(sp/1e6))
+}
@@ -0,0 +1,61 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/platinasystems/xeth"
+)
+
+func TestParseAdvertisement(t *testing.T) {
+	for _, x := range []struct {
+		in, out string
+		ok      bool
+		fastest float64
+	}{
+		{"all", "all", true, 100e9},
+		{"100g,40g", "40g,100g", true, 100e9},
+		{"1000m,10g", "1000m,10g", true, 10e9},
+		{"1g", "1000m", true, 1e9},
+		{"25g,5g", "", false, 0},
+		{"", "", false, 0},
+	} {
+		ad, err := parseAdvertisement(x.in)
+		if (err == nil) != x.ok {
+			t.Errorf("parseAdvertisement(%q): %v", x.in, err)
+			continue
+		}
+		if !x.ok {
+			continue
+		}
+		if got := ad.String(); got != x.out {
+			t.Errorf("parseAdvertisement(%q) = %q, want %q",
+				x.in, got, x.out)
+		}
+		if got := float64(ad.fastest()); got != x.fastest {
+			t.Errorf("%q fastest %g, want %g", x.in, got, x.fastest)
+		}
+	}
+}
+
+func TestLinkModesAdvertisement(t *testing.T) {
+	var bits xeth.EthtoolLinkModeBits
+	if _, found := linkModesAdvertisement(&bits); found {
+		t.Error("found modes in none")
+	}
+	// above bit 31
+	m := uint(xeth.ETHTOOL_LINK_MODE_100000baseCR4_Full)
+	bits[m/32] |= 1 << (m % 32)
+	m = uint(xeth.ETHTOOL_LINK_MODE_10000baseKR_Full)
+	bits[m/32] |= 1 << (m % 32)
+	ad, found := linkModesAdvertisement(&bits)
+	if !found || ad.String() != "10g,100g" {
+		t.Errorf("advertisement %q, %v; want 10g,100g", ad, found)
+	}
+	if !ad.has(100e9) || ad.has(40e9) {
+		t.Errorf("%s has 100g %v, 40g %v", ad, ad.has(100e9), ad.has(40e9))
+	}
+}
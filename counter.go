@@ -4,7 +4,11 @@
 
 package main
 
-import "strings"
+import (
+	"strings"
+
+	"github.com/platinasystems/xeth"
+)
 
 // translated counter name
 func xCounter(s string) string {
@@ -39,3 +43,16 @@ var linkStatTranslation = map[string]string{
 	"port-tx-runt-packets":          "tx-fifo-errors",
 	"port-tx-packets":               "tx-packets",
 }
+
+// Kernel link stat of a translated sw interface counter, if any.
+func swLinkStat(counter string) (string, bool) {
+	if x, found := swLinkStatTranslation[counter]; found {
+		counter = x
+	}
+	_, found := xeth.LinkStatOf(counter)
+	return counter, found
+}
+
+var swLinkStatTranslation = map[string]string{
+	"drops": "rx-dropped",
+}
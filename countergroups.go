@@ -0,0 +1,207 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/platinasystems/vnet"
+)
+
+// Counters matching a group are polled every "pollInterval.GROUP"
+// seconds instead of every pollInterval. Groups match the stats.go
+// counter names with,
+//
+//	prefix:PREFIX
+//	regex:REGEXP
+//
+// The first matching group wins; unmatched counters are polled at
+// pollInterval. Each group is its own event, rescheduled at its interval.
+// vnet reads all of an interface's counters together so a group saves
+// the processing and publication of those it leaves for later.
+type counterGroup struct {
+	vnet.Event
+	poller       *ifStatsPoller
+	name         string
+	spec         string
+	match        func(string) bool
+	pollInterval float64 // in seconds
+	sequence     uint
+	timing       pollTiming
+	// Set once startCounterGroups has signaled its first event.
+	started bool
+}
+
+// cpu is first to keep its mmu-tx-cpu-cos-*-drop-* counters out of
+// errors.
+var defaultCounterGroups = []struct {
+	name, spec   string
+	pollInterval float64
+}{
+	{"cpu", `regex:^mmu-tx-cpu-cos-|^tx-pipe-cpu-`, 60},
+	{"errors", `regex:error|crc|runt|undersize|oversize|fragment|jabber|drop`, 1},
+	{"link", `regex:^port-(rx|tx)-(bytes|packets)$`, 1},
+}
+
+func newCounterGroup(p *ifStatsPoller, name, spec string) (*counterGroup, error) {
+	g := &counterGroup{
+		poller:       p,
+		name:         name,
+		spec:         spec,
+		pollInterval: p.pollInterval,
+	}
+	switch {
+	case strings.HasPrefix(spec, "prefix:"):
+		prefix := strings.TrimPrefix(spec, "prefix:")
+		g.match = func(s string) bool {
+			return strings.HasPrefix(s, prefix)
+		}
+	case strings.HasPrefix(spec, "regex:"):
+		re, err := regexp.Compile(strings.TrimPrefix(spec, "regex:"))
+		if err != nil {
+			return nil, err
+		}
+		g.match = re.MatchString
+	default:
+		return nil, fmt.Errorf("%s: expected prefix: or regex:", spec)
+	}
+	return g, nil
+}
+
+func (g *counterGroup) addEvent(dt float64) {
+	g.poller.mk1.vnet.SignalEventAfter(g, dt)
+}
+
+func (g *counterGroup) String() string {
+	return fmt.Sprintf("redis stats poller group %s sequence %d",
+		g.name, g.sequence)
+}
+
+func (g *counterGroup) EventAction() {
+	p := g.poller
+	if i := p.groups.index(g.name); i < 0 || p.groups.list[i] != g {
+		// deleted
+		return
+	}
+	start := time.Now()
+	g.timing.begin(start)
+	p.pollCounters(start, g)
+	interval := time.Duration(g.pollInterval * float64(time.Second))
+	dt := g.timing.end(start, time.Now(), interval)
+	g.addEvent(dt.Seconds())
+	p.pubTiming("poll."+g.name, &g.timing)
+	g.sequence++
+}
+
+type counterGroups struct {
+	list []*counterGroup
+	// group of each raw counter name, nil for none
+	cache map[string]*counterGroup
+}
+
+// Signal the first event of groups added since the last call.
+func (p *ifStatsPoller) startCounterGroups() {
+	for _, g := range p.groups.list {
+		if !g.started {
+			g.started = true
+			g.addEvent(0)
+		}
+	}
+}
+
+func (gs *counterGroups) index(name string) int {
+	for i, g := range gs.list {
+		if g.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (p *ifStatsPoller) groupOf(counter string) *counterGroup {
+	gs := &p.groups
+	if g, found := gs.cache[counter]; found {
+		return g
+	}
+	if gs.cache == nil {
+		gs.cache = make(map[string]*counterGroup)
+	}
+	var match *counterGroup
+	name := counterSeparators().Replace(counter)
+	for _, g := range gs.list {
+		if g.match(name) {
+			match = g
+			break
+		}
+	}
+	gs.cache[counter] = match
+	return match
+}
+
+// Add, replace or, with spec "none", delete a group. A new group is
+// polled once started by startCounterGroups.
+func (p *ifStatsPoller) setCounterGroup(name, spec string) error {
+	gs := &p.groups
+	i := gs.index(name)
+	if name == "msec" {
+		return fmt.Errorf("%s: reserved group name", name)
+	}
+	if spec == "none" {
+		if i < 0 {
+			return fmt.Errorf("%s: no such group", name)
+		}
+		gs.list = append(gs.list[:i], gs.list[i+1:]...)
+		gs.cache = nil
+		return nil
+	}
+	g, err := newCounterGroup(p, name, spec)
+	if err != nil {
+		return err
+	}
+	if i >= 0 {
+		// keep the running event and its interval
+		old := gs.list[i]
+		old.spec, old.match = g.spec, g.match
+	} else {
+		gs.list = append(gs.list, g)
+	}
+	gs.cache = nil
+	p.pubq.send(fmt.Sprint("pollInterval.", name, ": ",
+		gs.list[gs.index(name)].pollInterval))
+	return nil
+}
+
+func (p *ifStatsPoller) setGroupInterval(name string, itv float64) error {
+	i := p.groups.index(name)
+	if i < 0 {
+		return fmt.Errorf("%s: no such counter group", name)
+	}
+	if itv < 1 {
+		return fmt.Errorf("pollInterval.%s must be 1 second or longer",
+			name)
+	}
+	p.groups.list[i].pollInterval = itv
+	return nil
+}
+
+func (p *ifStatsPoller) initCounterGroups() {
+	for _, x := range defaultCounterGroups {
+		err := p.setCounterGroup(x.name, x.spec)
+		if err == nil {
+			err = p.setGroupInterval(x.name, x.pollInterval)
+		}
+		if err != nil {
+			dbgVnetd.Log(err)
+		} else {
+			p.pubq.send(fmt.Sprint("pollInterval.", x.name, ": ",
+				x.pollInterval))
+			p.pubq.send(fmt.Sprint("counter-group.", x.name, ": ",
+				x.spec))
+		}
+	}
+}
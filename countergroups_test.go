@@ -0,0 +1,77 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import "testing"
+
+func TestDefaultCounterGroups(t *testing.T) {
+	p := &ifStatsPoller{pollInterval: 5}
+	p.pubq.init(64)
+	p.initCounterGroups()
+	for _, x := range []struct {
+		counter, group string
+		interval       float64
+	}{
+		{"mmu-tx-cpu-cos-0-drop-packets", "cpu", 60},
+		{"tx-pipe-cpu-packets", "cpu", 60},
+		{"port-rx-crc_error-packets", "errors", 1},
+		{"mmu-rx-threshold-drop-packets", "errors", 1},
+		{"port-rx-bytes", "link", 1},
+		{"port-tx-packets", "link", 1},
+		{"port-rx-multicast-packets", "", 5},
+	} {
+		g := p.groupOf(x.counter)
+		name, interval := "", p.pollInterval
+		if g != nil {
+			name, interval = g.name, g.pollInterval
+		}
+		if name != x.group || interval != x.interval {
+			t.Errorf("%s: group %q every %gs, want %q every %gs",
+				x.counter, name, interval, x.group, x.interval)
+		}
+	}
+}
+
+func TestSetCounterGroup(t *testing.T) {
+	p := &ifStatsPoller{pollInterval: 5}
+	p.pubq.init(64)
+	for _, name := range []string{"a", "b"} {
+		if err := p.setCounterGroup(name, "prefix:"+name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a := p.groups.list[0]
+	if a.poller != p || a.pollInterval != p.pollInterval || a.started {
+		t.Errorf("new group %+v", a)
+	}
+	if err := p.setGroupInterval("a", 60); err != nil {
+		t.Fatal(err)
+	}
+	// a replaced spec keeps the group's event and interval
+	if err := p.setCounterGroup("a", "regex:^a-"); err != nil {
+		t.Fatal(err)
+	}
+	if p.groups.list[0] != a || a.pollInterval != 60 {
+		t.Errorf("replaced group %+v", p.groups.list[0])
+	}
+	if g := p.groupOf("a-counter"); g != a {
+		t.Errorf("a-counter in %v", g)
+	}
+	if err := p.setCounterGroup("a", "none"); err != nil {
+		t.Fatal(err)
+	}
+	if g := p.groupOf("a-counter"); g != nil {
+		t.Errorf("deleted group %s still matches", g.name)
+	}
+	if i := p.groups.index("a"); i >= 0 {
+		t.Errorf("deleted group at %d", i)
+	}
+	if err := p.setCounterGroup("bad", "glob:*"); err == nil {
+		t.Error("accepted glob:")
+	}
+	if err := p.setCounterGroup("msec", "prefix:x"); err == nil {
+		t.Error("accepted group msec")
+	}
+}
@@ -6,6 +6,9 @@ package main
 
 import (
 	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/platinasystems/elib/parse"
 	"github.com/platinasystems/vnet"
@@ -20,8 +23,24 @@ type event struct {
 	err          chan error
 	newValue     chan string
 	isReadyEvent bool
+	// Signaled once EventAction is through with err and newValue.
+	done chan struct{}
+	// eventPending until either EventAction claims the event, before
+	// changing anything, or an expired set abandons it. An abandoned
+	// event is returned to the pool unapplied; a claimed one is applied
+	// and its set waits to publish the result.
+	state int32
 }
 
+const (
+	eventPending int32 = iota
+	eventClaimed
+	eventAbandoned
+)
+
+// Most time an Hset or Hget waits on the event loop.
+const rpcTimeout = 10 * time.Second
+
 func (e *event) String() string {
 	return fmt.Sprintf("redis set %s = %s", e.key, e.value)
 }
@@ -36,9 +55,19 @@ func (e *event) EventAction() {
 		itv    float64
 		fec    ethernet.ErrorCorrectionType
 		addr   string
+		names  string
+		mtu    uint
+		mode   string
+		vid    uint16
 	)
 	if e.isReadyEvent {
-		e.mk1.poller.pubch <- fmt.Sprint(e.key, ": ", e.value)
+		e.mk1.poller.pubq.send(fmt.Sprint(e.key, ": ", e.value))
+		e.mk1.eventPool.Put(e)
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&e.state, eventPending, eventClaimed) {
+		// the set timed out before the event loop got to it
+		e.put()
 		return
 	}
 	e.in.Init(nil)
@@ -87,6 +116,75 @@ func (e *event) EventAction() {
 			}
 			e.err <- err
 		}
+	case e.in.Parse("%v.mtu %d", &hi, v, &mtu):
+		err := e.mk1.setMtu(hi, mtu)
+		if err == nil {
+			e.newValue <- fmt.Sprint(v.HwIf(hi).MaxPacketSize())
+		}
+		e.err <- err
+	case e.in.Parse("%v.loopback %s", &hi, v, &mode):
+		err := e.mk1.setLoopback(hi, mode)
+		if err == nil {
+			e.newValue <- mode
+		}
+		e.err <- err
+	case e.in.Parse("%v.autoneg %v", &hi, v, &enable):
+		err := e.mk1.setAutoneg(hi, bool(enable))
+		if err == nil {
+			e.newValue <- fmt.Sprint(enable)
+		}
+		e.err <- err
+	case e.in.Parse("%v.advertise %s", &hi, v, &names):
+		err := e.mk1.setAdvertise(hi, names)
+		if err == nil {
+			e.newValue <- e.mk1.hwIfConfig(hi.Name(v)).advertise.String()
+		}
+		e.err <- err
+	case e.in.Parse("%v.pause %s", &hi, v, &mode):
+		e.err <- e.mk1.setPause(hi, mode)
+	case e.in.Parse("%v.pfc %s", &hi, v, &names):
+		e.err <- e.mk1.setPfc(hi, names)
+	case e.in.Parse("%v.pvid %d", &hi, v, &vid):
+		err := e.mk1.setPortVid(hi, vid)
+		if err == nil {
+			e.newValue <- fmt.Sprint(vid)
+		}
+		e.err <- err
+	case e.key == "counters" || strings.HasSuffix(e.key, ".counters"):
+		name := strings.TrimSuffix(e.key, "counters")
+		name = strings.TrimSuffix(name, ".")
+		if e.value != "clear" {
+			e.err <- fmt.Errorf("%s: expected clear", e.value)
+		} else if !e.mk1.poller.clearCounters(name) {
+			e.err <- fmt.Errorf("%s: no counters", name)
+		} else {
+			e.newValue <- time.Now().Format(time.RFC3339Nano)
+			e.err <- nil
+		}
+	case strings.HasPrefix(e.key, "alarm-rule."):
+		v, err := e.mk1.poller.setAlarm(strings.TrimPrefix(e.key,
+			"alarm-rule."), e.value)
+		if err == nil {
+			e.newValue <- v
+		}
+		e.err <- err
+	case e.in.Parse("alarms.file %s", &addr):
+		err := e.mk1.poller.loadAlarms(addr)
+		if err == nil {
+			e.newValue <- addr
+		}
+		e.err <- err
+	case e.key == "poll.filter":
+		f, err := parseCounterFilter(e.value)
+		if err == nil {
+			e.mk1.poller.filter = f
+			e.newValue <- f.String()
+		}
+		e.err <- err
+	case e.in.Parse("poll.json %v", &enable):
+		e.mk1.poller.json = bool(enable)
+		e.newValue <- fmt.Sprint(enable)
+		e.err <- nil
 	case e.in.Parse("pollInterval %f", &itv):
 		if itv < 1 {
 			e.err <- fmt.Errorf("pollInterval must be 1 second or longer")
@@ -103,10 +201,75 @@ func (e *event) EventAction() {
 			e.newValue <- fmt.Sprintf("%f", itv)
 			e.err <- nil
 		}
-	case e.in.Parse("kafka-broker %s", &addr):
-		e.mk1.initProducer(addr)
-		e.newValue <- fmt.Sprintf("%s", addr)
+	case strings.HasPrefix(e.key, "pollInterval."):
+		name := strings.TrimPrefix(e.key, "pollInterval.")
+		_, err := fmt.Sscan(e.value, &itv)
+		if err == nil {
+			err = e.mk1.poller.setGroupInterval(name, itv)
+		}
+		if err == nil {
+			e.newValue <- fmt.Sprintf("%f", itv)
+		}
+		e.err <- err
+	case strings.HasPrefix(e.key, "counter-group."):
+		err := e.mk1.poller.setCounterGroup(strings.TrimPrefix(e.key,
+			"counter-group."), e.value)
+		if err == nil {
+			e.mk1.poller.startCounterGroups()
+			e.newValue <- e.value
+		}
+		e.err <- err
+	case e.key == "kafka-broker":
+		// like hf-sink, "none" or empty closes the producer
+		var sink hfSink
+		var err error
+		if e.value != "" && e.value != "none" {
+			sink, err = newKafkaProducer(e.value)
+		}
+		if err == nil {
+			e.mk1.hfSinker.set(sink)
+			e.newValue <- e.value
+		}
+		e.err <- err
+	case e.in.Parse("hf-sink %s", &addr):
+		var sink hfSink
+		var err error
+		if addr != "none" {
+			sink, err = newHfSink(addr)
+		}
+		if err == nil {
+			e.mk1.hfSinker.set(sink)
+			e.newValue <- addr
+		}
+		e.err <- err
+	case e.in.Parse("metrics-listen %s", &addr):
+		if addr == "none" {
+			addr = ""
+		}
+		err := e.mk1.initMetrics(addr)
+		if err == nil {
+			e.newValue <- addr
+		}
+		e.err <- err
+	case e.in.Parse("hf-interfaces %s", &names):
+		e.mk1.fastPoller.interfaces = newHfSelection(names)
+		e.mk1.fastPoller.configHfCounters()
+		e.newValue <- e.mk1.fastPoller.interfaces.String()
 		e.err <- nil
+	case e.in.Parse("hf-counters %s", &names):
+		e.mk1.fastPoller.counters = newHfSelection(names)
+		e.mk1.fastPoller.configHfCounters()
+		e.newValue <- e.mk1.fastPoller.counters.String()
+		e.err <- nil
+	case e.in.Parse("influx %s", &addr):
+		if addr == "none" {
+			addr = ""
+		}
+		err := e.mk1.influx.set(addr)
+		if err == nil {
+			e.newValue <- addr
+		}
+		e.err <- err
 	case e.in.Parse("unresolved-arpInterval %f", &itv):
 		if itv < 1 {
 			e.err <- fmt.Errorf("unresolvedArpInterval must be 1 second or longer")
@@ -118,5 +281,22 @@ func (e *event) EventAction() {
 	default:
 		e.err <- fmt.Errorf("can't set %s to %v", e.key, e.value)
 	}
+	if len(e.err) == 0 {
+		e.err <- fmt.Errorf("%s: no reply", e.key)
+	}
+	e.done <- struct{}{}
+}
+
+// Drain the replies of an expired set and return the event to the pool.
+func (e *event) put() {
+	for len(e.err) > 0 {
+		<-e.err
+	}
+	for len(e.newValue) > 0 {
+		<-e.newValue
+	}
+	for len(e.done) > 0 {
+		<-e.done
+	}
 	e.mk1.eventPool.Put(e)
 }
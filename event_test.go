@@ -0,0 +1,50 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import "testing"
+
+func testSetEvent(state int32) (*Mk1, *event) {
+	mk1 := new(Mk1)
+	mk1.eventPool.New = mk1.newEvent
+	mk1.poller.pubq.init(16)
+	mk1.poller.pollInterval = 5
+	e := mk1.eventPool.Get().(*event)
+	e.key, e.value = "pollInterval", "30"
+	e.state = state
+	return mk1, e
+}
+
+func TestEventAbandoned(t *testing.T) {
+	mk1, e := testSetEvent(eventAbandoned)
+	e.EventAction()
+	if mk1.poller.pollInterval != 5 {
+		t.Errorf("timed out set applied: pollInterval %g",
+			mk1.poller.pollInterval)
+	}
+	if n := len(e.err) + len(e.newValue) + len(e.done); n != 0 {
+		t.Errorf("%d replies left in pooled event", n)
+	}
+}
+
+func TestEventClaimed(t *testing.T) {
+	mk1, e := testSetEvent(eventPending)
+	e.EventAction()
+	if e.state != eventClaimed {
+		t.Errorf("state %d, want claimed", e.state)
+	}
+	if mk1.poller.pollInterval != 30 {
+		t.Errorf("pollInterval %g, want 30", mk1.poller.pollInterval)
+	}
+	if len(e.done) != 1 {
+		t.Fatal("done not signaled")
+	}
+	if err := <-e.err; err != nil {
+		t.Error(err)
+	}
+	if v := <-e.newValue; v != "30.000000" {
+		t.Errorf("new value %q", v)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const defaultFilterFile = "/etc/goes/vnet-poll-filter.yaml"
+
+// Glob patterns over translated counter names (see xCounter) that
+// select which counters are published to redis and xeth. With no
+// include patterns everything not excluded is published. As a
+// "poll.filter" value these are comma separated with a leading '-' to
+// exclude, e.g. "-tx-pipe-cpu-*,-mmu-tx-cpu-cos-*"; as a file,
+//
+//	include: [rx-*, tx-*]
+//	exclude: [tx-pipe-cpu-*]
+type counterFilter struct {
+	Include []string `yaml:"include,omitempty"`
+	Exclude []string `yaml:"exclude,omitempty"`
+	// decision by raw counter name
+	cache map[string]bool
+}
+
+func parseCounterFilter(s string) (*counterFilter, error) {
+	f := new(counterFilter)
+	if s == "none" {
+		return f, nil
+	}
+	for _, pat := range strings.Split(s, ",") {
+		switch {
+		case pat == "":
+		case pat[0] == '-':
+			f.Exclude = append(f.Exclude, pat[1:])
+		default:
+			f.Include = append(f.Include, strings.TrimPrefix(pat, "+"))
+		}
+	}
+	return f, f.validate()
+}
+
+func (f *counterFilter) validate() error {
+	for _, pats := range [][]string{f.Include, f.Exclude} {
+		for _, pat := range pats {
+			if _, err := path.Match(pat, ""); err != nil {
+				return fmt.Errorf("%s: %v", pat, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (f *counterFilter) String() string {
+	pats := make([]string, 0, len(f.Include)+len(f.Exclude))
+	pats = append(pats, f.Include...)
+	for _, pat := range f.Exclude {
+		pats = append(pats, "-"+pat)
+	}
+	if len(pats) == 0 {
+		return "none"
+	}
+	return strings.Join(pats, ",")
+}
+
+func matchAny(pats []string, s string) bool {
+	for _, pat := range pats {
+		if match, _ := path.Match(pat, s); match {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether to publish the given raw counter.
+func (f *counterFilter) allows(counter string) bool {
+	if f == nil {
+		return true
+	}
+	if ok, found := f.cache[counter]; found {
+		return ok
+	}
+	if f.cache == nil {
+		f.cache = make(map[string]bool)
+	}
+	name := xCounter(counter)
+	ok := (len(f.Include) == 0 || matchAny(f.Include, name)) &&
+		!matchAny(f.Exclude, name)
+	f.cache[counter] = ok
+	return ok
+}
+
+func (p *ifStatsPoller) setFilter(f *counterFilter) {
+	p.filter = f
+	p.pubq.send(fmt.Sprint("poll.filter: ", f))
+}
+
+// Load the default filter file, if present.
+func (p *ifStatsPoller) initFilter() {
+	b, err := ioutil.ReadFile(defaultFilterFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			dbgVnetd.Log(err)
+		}
+		p.setFilter(new(counterFilter))
+		return
+	}
+	f := new(counterFilter)
+	if err = yaml.Unmarshal(b, f); err == nil {
+		err = f.validate()
+	}
+	if err != nil {
+		dbgVnetd.Log(defaultFilterFile, err)
+		f = new(counterFilter)
+	}
+	p.setFilter(f)
+}
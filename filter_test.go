@@ -0,0 +1,56 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestParseCounterFilter(t *testing.T) {
+	for _, x := range []struct {
+		in, out string
+		ok      bool
+		allows  []string
+		denies  []string
+	}{
+		{"none", "none", true, []string{"port-rx-bytes"}, nil},
+		{"-tx-pipe-cpu-*,-mmu-tx-cpu-cos-*",
+			"-tx-pipe-cpu-*,-mmu-tx-cpu-cos-*", true,
+			[]string{"port-rx-bytes"},
+			[]string{"tx-pipe-cpu-packets", "mmu-tx-cpu-cos-0-drop-bytes"}},
+		// included by translated name
+		{"rx-*,+tx-bytes", "rx-*,tx-bytes", true,
+			[]string{"port-rx-bytes", "port-tx-bytes"},
+			[]string{"port-tx-packets"}},
+		{"rx-*,-rx-crc-errors", "rx-*,-rx-crc-errors", true,
+			[]string{"port-rx-packets"},
+			[]string{"port-rx-crc_error-packets"}},
+		{",,", "none", true, []string{"port-rx-bytes"}, nil},
+		{"rx-[", "", false, nil, nil},
+	} {
+		f, err := parseCounterFilter(x.in)
+		if (err == nil) != x.ok {
+			t.Errorf("parseCounterFilter(%q): %v", x.in, err)
+			continue
+		}
+		if !x.ok {
+			continue
+		}
+		if got := f.String(); got != x.out {
+			t.Errorf("parseCounterFilter(%q) = %q, want %q",
+				x.in, got, x.out)
+		}
+		for _, counter := range x.allows {
+			if !f.allows(counter) {
+				t.Errorf("%q denies %s", x.in, counter)
+			}
+		}
+		for _, counter := range x.denies {
+			if f.allows(counter) {
+				t.Errorf("%q allows %s", x.in, counter)
+			}
+		}
+	}
+}
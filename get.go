@@ -0,0 +1,189 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/redis/rpc/args"
+	"github.com/platinasystems/redis/rpc/reply"
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/vnet/ethernet"
+)
+
+// Read of the live vnet state by the same keys accepted by
+// event.EventAction.
+type getEvent struct {
+	vnet.Event
+	mk1 *Mk1
+	// empty for all
+	field  string
+	values map[string]string
+	done   chan struct{}
+}
+
+func (e *getEvent) String() string {
+	if e.field == "" {
+		return "redis getall"
+	}
+	return fmt.Sprintf("redis get %s", e.field)
+}
+
+func (e *getEvent) EventAction() {
+	e.mk1.getConfig(e.values)
+	if _, found := e.values[e.field]; e.field == "" || !found {
+		e.mk1.getCounters(e.values)
+	}
+	close(e.done)
+}
+
+func (mk1 *Mk1) get(field string) (map[string]string, error) {
+	e := &getEvent{
+		mk1:    mk1,
+		field:  field,
+		values: make(map[string]string),
+		done:   make(chan struct{}),
+	}
+	mk1.vnet.SignalEvent(e)
+	timer := time.NewTimer(rpcTimeout)
+	defer timer.Stop()
+	select {
+	case <-e.done:
+		return e.values, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("%s: timeout after %v", e, rpcTimeout)
+	}
+}
+
+func (mk1 *Mk1) Hget(args args.Hget, reply *reply.Hget) error {
+	field := strings.TrimPrefix(args.Field, "vnet.")
+	values, err := mk1.get(field)
+	if err != nil {
+		return err
+	}
+	s, found := values[field]
+	if !found {
+		return fmt.Errorf("%s: not found", args.Field)
+	}
+	*reply = []byte(s)
+	return nil
+}
+
+func (mk1 *Mk1) Hgetall(args args.Hgetall, reply *reply.Hgetall) error {
+	values, err := mk1.get("")
+	if err != nil {
+		return err
+	}
+	fields := make([]string, 0, len(values))
+	for field := range values {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		reply.Sappend("vnet." + field)
+		reply.Sappend(values[field])
+	}
+	return nil
+}
+
+// Interface config and poll settings formatted as their publication.
+func (mk1 *Mk1) getConfig(values map[string]string) {
+	v := &mk1.vnet
+	p := &mk1.poller
+	v.ForeachHwIf(mk1.unixInterfacesOnly, func(hi vnet.Hi) {
+		if !mk1.hw_is_ok(hi) {
+			return
+		}
+		h := v.HwIf(hi)
+		ifname := hi.Name(v)
+		values[ifname+".speed"] = h.Speed().String()
+		values[ifname+".media"] = h.Media()
+		values[ifname+".mtu"] = fmt.Sprint(h.MaxPacketSize())
+		values[ifname+".class"] = mk1.hwIfClass(hi).String()
+		c := mk1.hwIfConfig(ifname)
+		values[ifname+".link"] = fmt.Sprint(parse.Enable(h.IsLinkUp()))
+		values[ifname+".link-loopback"] = c.linkLoopback()
+		if c.loopback != "" {
+			values[ifname+".loopback"] = c.loopback
+		}
+		values[ifname+".autoneg"] = fmt.Sprint(parse.Enable(h.Speed() == 0))
+		values[ifname+".advertise"] = c.advertise.String()
+		if c.pvid != "" {
+			values[ifname+".pvid"] = c.pvid
+		}
+		if c.autonegSpeed != "" {
+			values[ifname+".autoneg.speed"] = c.autonegSpeed
+			values[ifname+".autoneg.partner"] = c.autonegPartner
+		}
+		if h, ok := v.HwIfer(hi).(ethernet.HwInterfacer); ok {
+			values[ifname+".fec"] =
+				h.GetInterface().ErrorCorrectionType.String()
+		}
+	})
+	v.ForeachSwIf(func(si vnet.Si) {
+		if mk1.sw_is_ok(si) {
+			ifname := vnet.SiName{V: v, Si: si}.String()
+			values[ifname+".admin"] =
+				fmt.Sprint(parse.Enable(si.IsAdminUp(v)))
+		}
+	})
+	values["pollInterval"] = fmt.Sprintf("%f", p.pollInterval)
+	values["pollInterval.msec"] =
+		fmt.Sprintf("%f", mk1.fastPoller.pollInterval)
+	for _, g := range p.groups.list {
+		values["pollInterval."+g.name] = fmt.Sprintf("%f", g.pollInterval)
+		values["counter-group."+g.name] = g.spec
+	}
+	values["poll.filter"] = p.filter.String()
+	values["poll.json"] = fmt.Sprint(parse.Enable(p.json))
+	values["hf-interfaces"] = mk1.fastPoller.interfaces.String()
+	values["hf-counters"] = mk1.fastPoller.counters.String()
+	values["unresolved-arpInterval"] =
+		fmt.Sprintf("%f", mk1.unresolvedArper.pollInterval)
+	values["kafka-broker"] = ""
+	values["hf-sink"] = ""
+	if sink := mk1.hfSinker.get(); sink != nil {
+		values["hf-sink"] = sink.String()
+		if k, ok := sink.(*kafkaProducer); ok {
+			values["kafka-broker"] = k.broker + "/" + k.topic
+		}
+	}
+	values["metrics-listen"] = mk1.metrics.addr
+	values["influx"] = ""
+	if ep := mk1.influx.endpoint(); ep != nil {
+		values["influx"] = ep.spec
+	}
+	for counter, r := range p.alarmRules {
+		values["alarm-rule."+counter] = r.String()
+	}
+}
+
+// Counters relative to their last clear, by translated name, as of the
+// last poll.
+func (mk1 *Mk1) getCounters(values map[string]string) {
+	p := &mk1.poller
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, ifs := range []ifStatsPollerInterfaceVec{
+		p.hwInterfaces,
+		p.swInterfaces,
+	} {
+		for i := range ifs {
+			psi := &ifs[i]
+			if psi.name == "" {
+				continue
+			}
+			for counter, c := range psi.lastValues {
+				key := fmt.Sprint(psi.name, ".", xCounter(counter))
+				values[key] = fmt.Sprint(psi.relative(counter,
+					c.value))
+			}
+		}
+	}
+}
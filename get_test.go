@@ -0,0 +1,37 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetCounters(t *testing.T) {
+	mk1 := new(Mk1)
+	p := &mk1.poller
+	p.hwInterfaces.Validate(1)
+	psi := &p.hwInterfaces[1]
+	psi.name = "xeth1"
+	now := time.Now()
+	psi.update("port-rx-bytes", 100, now)
+	psi.update("port-tx-packets", 7, now)
+	psi.clear(nil)
+	psi.update("port-rx-bytes", 150, now.Add(time.Second))
+	values := make(map[string]string)
+	mk1.getCounters(values)
+	want := map[string]string{
+		"xeth1.rx-bytes":   "50",
+		"xeth1.tx-packets": "0",
+	}
+	if len(values) != len(want) {
+		t.Errorf("values %v, want %v", values, want)
+	}
+	for k, v := range want {
+		if values[k] != v {
+			t.Errorf("%s = %q, want %q", k, values[k], v)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// One fastIfStatsPoller sample of an interface. Values are the comma
+// separated counter deltas in the column order published as hf.header,
+// empty for counters that the interface doesn't sample.
+type hfRecord struct {
+	Host   string `json:"host"`
+	Msec   int64  `json:"msec"`
+	Ifname string `json:"ifname"`
+	Values string `json:"values"`
+}
+
+func (r *hfRecord) String() string {
+	return fmt.Sprintf("%s,%d,%s,%s", r.Host, r.Msec, r.Ifname, r.Values)
+}
+
+// Destination of high frequency counters.
+type hfSink interface {
+	Write(*hfRecord) error
+	Close() error
+	String() string
+}
+
+// Sinks that buffer Write until Flush, which returns the number of
+// records buffered, delivered or not.
+type hfBatcher interface {
+	Flush() (int, error)
+}
+
+// Most records gopublishHf writes before a Flush.
+const hfBatchRecords = 1024
+
+// Parse sink specs of the form,
+//
+//	file:PATH[,MAXBYTES]
+//	unix:PATH	(@PATH for abstract)
+//	kafka:HOST:PORT[/TOPIC]
+func newHfSink(spec string) (hfSink, error) {
+	i := strings.Index(spec, ":")
+	if i < 0 {
+		return nil, fmt.Errorf("%s: missing sink type", spec)
+	}
+	kind, arg := spec[:i], spec[i+1:]
+	switch kind {
+	case "file":
+		return newHfFileSink(arg)
+	case "unix":
+		return newHfUnixSink(arg)
+	case "kafka":
+		return newKafkaProducer(arg)
+	}
+	return nil, fmt.Errorf("%s: unknown sink type", kind)
+}
+
+// The event loop swaps the active sink without locking while
+// gopublishHf, the only user of sinks, writes, flushes and closes them.
+type hfSinker struct {
+	// hfSinkValue of the active sink
+	cur atomic.Value
+	// mu guards retired, replaced sinks that gopublishHf is signaled
+	// through retire to close.
+	mu       sync.Mutex
+	retired  []hfSink
+	retire   chan struct{}
+	msgCount uint64
+	failures uint64
+	lastErr  atomic.Value
+}
+
+// atomic.Value won't store a nil interface.
+type hfSinkValue struct{ hfSink }
+
+func (s *hfSinker) get() hfSink {
+	v, _ := s.cur.Load().(hfSinkValue)
+	return v.hfSink
+}
+
+// Activate sink, nil for none; never blocks.
+func (s *hfSinker) set(sink hfSink) {
+	old := s.get()
+	s.cur.Store(hfSinkValue{sink})
+	if old == nil {
+		return
+	}
+	s.mu.Lock()
+	s.retired = append(s.retired, old)
+	s.mu.Unlock()
+	select {
+	case s.retire <- struct{}{}:
+	default:
+	}
+}
+
+func (s *hfSinker) active() bool { return s.get() != nil }
+
+func (s *hfSinker) closeRetired() {
+	s.mu.Lock()
+	retired := s.retired
+	s.retired = nil
+	s.mu.Unlock()
+	for _, sink := range retired {
+		sink.Close()
+	}
+}
+
+func (s *hfSinker) write(sink hfSink, r *hfRecord) {
+	if err := sink.Write(r); err != nil {
+		s.fail(1, err)
+	} else if _, ok := sink.(hfBatcher); !ok {
+		atomic.AddUint64(&s.msgCount, 1)
+	}
+}
+
+func (s *hfSinker) flush(sink hfSink) {
+	b, ok := sink.(hfBatcher)
+	if !ok {
+		return
+	}
+	if n, err := b.Flush(); err != nil {
+		s.fail(n, err)
+	} else {
+		atomic.AddUint64(&s.msgCount, uint64(n))
+	}
+}
+
+func (s *hfSinker) fail(n int, err error) {
+	atomic.AddUint64(&s.failures, uint64(n))
+	s.lastErr.Store(err.Error())
+}
+
+// Publish delivery and fast poller stats under vnet.hf.*
+func (mk1 *Mk1) pubHf() {
+	s := &mk1.hfSinker
+	p := &mk1.fastPoller
+	mk1.poller.pubq.send(fmt.Sprint("hf.header: host,msec,ifname,",
+		strings.Join(p.header, ",")))
+	mk1.poller.pubq.send(fmt.Sprint("hf.overruns: ", p.overruns))
+	mk1.poller.pubq.send(fmt.Sprint("hf.dropped: ", p.dropped))
+	var resets, wraps uint64
+	for i := range p.hwInterfaces {
+		resets += p.hwInterfaces[i].resets
+		wraps += p.hwInterfaces[i].wraps
+	}
+	mk1.poller.pubq.send(fmt.Sprint("hf.counters.reset-count: ", resets))
+	mk1.poller.pubq.send(fmt.Sprint("hf.counters.wrap-count: ", wraps))
+	mk1.poller.pubq.send(fmt.Sprint("hf.msg-count: ",
+		atomic.LoadUint64(&s.msgCount)))
+	mk1.poller.pubq.send(fmt.Sprint("hf.delivery-failures: ",
+		atomic.LoadUint64(&s.failures)))
+	if err, ok := s.lastErr.Load().(string); ok {
+		mk1.poller.pubq.send(fmt.Sprint("hf.last-error: ", err))
+	}
+}
+
+const defaultHfFileMaxBytes = 64 << 20
+
+// NDJSON to a local file, rotated to FILE.1 after maxBytes.
+type hfFileSink struct {
+	name     string
+	maxBytes int64
+	size     int64
+	f        *os.File
+}
+
+func newHfFileSink(arg string) (*hfFileSink, error) {
+	s := &hfFileSink{name: arg, maxBytes: defaultHfFileMaxBytes}
+	if i := strings.Index(arg, ","); i >= 0 {
+		s.name = arg[:i]
+		if _, err := fmt.Sscan(arg[i+1:], &s.maxBytes); err != nil {
+			return nil, err
+		}
+	}
+	return s, s.open()
+}
+
+func (s *hfFileSink) open() error {
+	f, err := os.OpenFile(s.name, os.O_WRONLY|os.O_CREATE|os.O_APPEND,
+		0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.f = f
+	s.size = fi.Size()
+	return nil
+}
+
+func (s *hfFileSink) rotate() error {
+	s.f.Close()
+	s.f = nil
+	if err := os.Rename(s.name, s.name+".1"); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+func (s *hfFileSink) Write(r *hfRecord) error {
+	if s.f == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if s.size+int64(len(b)) > s.maxBytes {
+		if err = s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.f.Write(b)
+	s.size += int64(n)
+	return err
+}
+
+func (s *hfFileSink) Close() error {
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
+
+func (s *hfFileSink) String() string { return "file:" + s.name }
+
+// CSV datagrams to a unix socket.
+type hfUnixSink struct {
+	addr *net.UnixAddr
+	conn *net.UnixConn
+}
+
+func newHfUnixSink(arg string) (*hfUnixSink, error) {
+	addr, err := net.ResolveUnixAddr("unixgram", arg)
+	if err != nil {
+		return nil, err
+	}
+	return &hfUnixSink{addr: addr}, nil
+}
+
+func (s *hfUnixSink) Write(r *hfRecord) error {
+	if s.conn == nil {
+		conn, err := net.DialUnix("unixgram", nil, s.addr)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	_, err := s.conn.Write([]byte(r.String()))
+	if err != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+func (s *hfUnixSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *hfUnixSink) String() string { return "unix:" + s.addr.Name }
@@ -0,0 +1,131 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestNewHfSelection(t *testing.T) {
+	for _, x := range []struct {
+		in, out string
+		has     []string
+		hasnt   []string
+	}{
+		{"all", "all", []string{"xeth1", "anything"}, nil},
+		{"xeth2,xeth1", "xeth1,xeth2", []string{"xeth1", "xeth2"},
+			[]string{"xeth3"}},
+		{"rx-bytes,,", "rx-bytes", []string{"rx-bytes"},
+			[]string{""}},
+		{"", "", nil, []string{"xeth1"}},
+	} {
+		sel := newHfSelection(x.in)
+		if got := sel.String(); got != x.out {
+			t.Errorf("newHfSelection(%q) = %q, want %q", x.in, got, x.out)
+		}
+		for _, name := range x.has {
+			if !sel.has(name) {
+				t.Errorf("%q doesn't have %q", x.in, name)
+			}
+		}
+		for _, name := range x.hasnt {
+			if sel.has(name) {
+				t.Errorf("%q has %q", x.in, name)
+			}
+		}
+	}
+}
+
+func TestNewHfColumns(t *testing.T) {
+	header, cols := newHfColumns([]string{
+		// xeth1
+		"tx-bytes", "rx-bytes",
+		// xeth2, in another order and with one more
+		"rx-bytes", "rx-crc-errors", "tx-bytes",
+	})
+	want := []string{"rx-bytes", "rx-crc-errors", "tx-bytes"}
+	if len(header) != len(want) || len(cols) != len(want) {
+		t.Fatalf("header %q, columns %v; want %q", header, cols, want)
+	}
+	for i, name := range want {
+		if header[i] != name || cols[name] != i {
+			t.Errorf("%s: header[%d] %q, column %d", name, i,
+				header[i], cols[name])
+		}
+	}
+	if header, cols = newHfColumns(nil); len(header) != 0 || len(cols) != 0 {
+		t.Errorf("no names gave %q, %v", header, cols)
+	}
+}
+
+func TestUpdateHf(t *testing.T) {
+	for _, x := range []struct {
+		counter       string
+		first, second uint64
+		delta         uint64
+	}{
+		// translated "multicast" and "collisions" are deltas too
+		{"port-rx-multicast-packets", 100, 150, 50},
+		{"port-tx-total-collisions", 7, 9, 2},
+		{"port-rx-bytes", 1000, 3000, 2000},
+		// levels are as is
+		{"mmu-rx-threshold-drops-cells", 5, 3, 3},
+	} {
+		var psi ifStatsPollerInterface
+		psi.updateHf(x.counter, x.first)
+		delta, updated := psi.updateHf(x.counter, x.second)
+		if !updated || delta != x.delta {
+			t.Errorf("%s: %d to %d gave %d, %v; want %d",
+				x.counter, x.first, x.second, delta, updated, x.delta)
+		}
+	}
+}
+
+type testHfSink struct {
+	records []*hfRecord
+	closed  bool
+}
+
+func (s *testHfSink) Write(r *hfRecord) error {
+	s.records = append(s.records, r)
+	return nil
+}
+
+func (s *testHfSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func (s *testHfSink) String() string { return "test" }
+
+func TestHfSinkerSet(t *testing.T) {
+	s := &hfSinker{retire: make(chan struct{}, 1)}
+	if s.active() {
+		t.Fatal("active without a sink")
+	}
+	a, b := new(testHfSink), new(testHfSink)
+	s.set(a)
+	s.write(s.get(), &hfRecord{Ifname: "xeth1"})
+	s.set(b)
+	s.set(nil)
+	if s.active() {
+		t.Error("active after set(nil)")
+	}
+	if a.closed || b.closed {
+		t.Error("closed by set")
+	}
+	select {
+	case <-s.retire:
+		s.closeRetired()
+	default:
+		t.Fatal("retire not signaled")
+	}
+	if !a.closed || !b.closed {
+		t.Error("retired sinks not closed")
+	}
+	if len(a.records) != 1 || s.msgCount != 1 {
+		t.Errorf("%d records, msg-count %d", len(a.records), s.msgCount)
+	}
+}
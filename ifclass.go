@@ -0,0 +1,139 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/xeth"
+)
+
+// Interface classification from xeth devtype and vnet.Ports.
+type ifClass uint8
+
+const (
+	// front panel xeth port
+	ifClassPort ifClass = 1 << iota
+	// xeth port of a broken out front panel port
+	ifClassSubport
+	// internal fe1 port, e.g. fe1-cpu
+	ifClassFe1
+	// vnet packet generator
+	ifClassPg
+	// management ethernet
+	ifClassMgmt
+	ifClassOther
+
+	ifClassAny ifClass = 1<<iota - 1
+)
+
+// Interfaces selected by the stats poller, xeth speed sync and
+// link/admin publication.
+const (
+	ifClassesPolled    = ifClassAny &^ ifClassPg
+	ifClassesSpeedSync = ifClassPort | ifClassSubport
+	ifClassesPublished = ifClassAny &^ ifClassPg
+)
+
+// DriverName of vnet's packet generator and of its ixge driver, which
+// runs the meth punt and inject ports when the kernel's ixgbe doesn't.
+const (
+	pgDriverName   = "packet-generator"
+	ixgeDriverName = "ixge"
+)
+
+// Last resort when neither vnet.Ports nor the driver tells.
+var (
+	pgIfRegexp   = regexp.MustCompile(`^pg[0-9]+$`)
+	mgmtIfRegexp = regexp.MustCompile(`^(meth-?[0-9]+|eth[0-9]+)$`)
+)
+
+var ifClassNames = map[ifClass]string{
+	ifClassPort:    "port",
+	ifClassSubport: "subport",
+	ifClassFe1:     "fe1",
+	ifClassPg:      "pg",
+	ifClassMgmt:    "mgmt",
+	ifClassOther:   "other",
+}
+
+func (c ifClass) String() string {
+	if s, found := ifClassNames[c]; found {
+		return s
+	}
+	var names []string
+	for bit := ifClassPort; bit <= ifClassOther; bit <<= 1 {
+		if c&bit != 0 {
+			names = append(names, ifClassNames[bit])
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+func (c ifClass) has(class ifClass) bool { return c&class != 0 }
+
+// Class of a hw interface by its xeth devtype in vnet.Ports, else its
+// driver: a port driver's interface that isn't an xeth port is internal
+// to the fe1, e.g. fe1-cpu.
+func ifClassOf(ifname, driver, portDriver string) ifClass {
+	if entry, found := vnet.Ports.GetPortByName(ifname); found &&
+		entry.Devtype == xeth.XETH_DEVTYPE_XETH_PORT {
+		if vnet.Ports.GetNumSubports(ifname) > 1 {
+			return ifClassSubport
+		}
+		return ifClassPort
+	}
+	switch {
+	case driver == pgDriverName:
+		return ifClassPg
+	case driver == ixgeDriverName:
+		return ifClassMgmt
+	case driver != "" && driver == portDriver:
+		return ifClassFe1
+	}
+	switch {
+	case strings.HasPrefix(ifname, "fe1-"):
+		return ifClassFe1
+	case pgIfRegexp.MatchString(ifname):
+		return ifClassPg
+	case mgmtIfRegexp.MatchString(ifname):
+		return ifClassMgmt
+	}
+	return ifClassOther
+}
+
+func (mk1 *Mk1) hwIfClass(hi vnet.Hi) ifClass {
+	v := &mk1.vnet
+	return ifClassOf(hi.Name(v), v.HwIfer(hi).DriverName(),
+		mk1.portDriver())
+}
+
+// DriverName of the xeth ports' hw interfaces, learned from the first
+// provisioned; empty until then.
+func (mk1 *Mk1) portDriver() string {
+	if mk1.xethPortDriver != "" {
+		return mk1.xethPortDriver
+	}
+	vnet.Ports.Foreach(func(ifname string, entry *vnet.PortEntry) {
+		if mk1.xethPortDriver != "" ||
+			entry.Devtype != xeth.XETH_DEVTYPE_XETH_PORT {
+			return
+		}
+		if hi, found := mk1.vnet.HwIfByName(ifname); found {
+			mk1.xethPortDriver = mk1.vnet.HwIfer(hi).DriverName()
+		}
+	})
+	return mk1.xethPortDriver
+}
+
+// Class of a software interface is that of its supporting hw interface.
+func (mk1 *Mk1) swIfClass(si vnet.Si) ifClass {
+	if h := mk1.vnet.HwIferForSupSi(si); h != nil {
+		return mk1.hwIfClass(h.GetHwIf().Hi())
+	}
+	return ifClassOther
+}
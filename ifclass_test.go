@@ -0,0 +1,48 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/xeth"
+)
+
+func TestIfClassOf(t *testing.T) {
+	for _, name := range []string{"xethpg1", "xeth2-1", "xeth2-2"} {
+		entry := vnet.Ports.SetPort(name)
+		entry.Devtype = xeth.XETH_DEVTYPE_XETH_PORT
+		if name != "xethpg1" {
+			entry.Portindex = 2
+		} else {
+			entry.Portindex = 1
+		}
+		defer vnet.Ports.UnsetPort(name)
+	}
+	for _, x := range []struct {
+		ifname, driver string
+		class          ifClass
+	}{
+		// a port name containing pg is still a port
+		{"xethpg1", "fe1", ifClassPort},
+		{"xeth2-1", "fe1", ifClassSubport},
+		{"pg0", pgDriverName, ifClassPg},
+		{"stream", pgDriverName, ifClassPg},
+		{"meth-0", ixgeDriverName, ifClassMgmt},
+		{"fe1-cpu", "fe1", ifClassFe1},
+		{"fe1-pipe0-loopback", "fe1", ifClassFe1},
+		// names only without a driver to go by
+		{"pg1", "", ifClassPg},
+		{"eth0", "", ifClassMgmt},
+		{"fe1-cpu", "", ifClassFe1},
+		{"tap0", "tuntap", ifClassOther},
+	} {
+		if got := ifClassOf(x.ifname, x.driver, "fe1"); got != x.class {
+			t.Errorf("%s by %q: %v, want %v", x.ifname, x.driver,
+				got, x.class)
+		}
+	}
+}
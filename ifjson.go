@@ -0,0 +1,93 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// The vnet.IF.json document; built from the same config, counters and
+// rates as the flat keys.
+type ifDoc struct {
+	Time     string                 `json:"time"`
+	Config   *ifDocConfig           `json:"config,omitempty"`
+	Counters map[string]uint64      `json:"counters"`
+	Rates    map[string]json.Number `json:"rates,omitempty"`
+}
+
+type ifDocConfig struct {
+	Speed    string `json:"speed,omitempty"`
+	Media    string `json:"media,omitempty"`
+	Fec      string `json:"fec,omitempty"`
+	Mtu      string `json:"mtu,omitempty"`
+	Loopback string `json:"loopback,omitempty"`
+	Autoneg  string `json:"autoneg,omitempty"`
+	Class    string `json:"class,omitempty"`
+	Admin    string `json:"admin,omitempty"`
+	Link     string `json:"link,omitempty"`
+}
+
+func (p *ifStatsPoller) addIfDocs(docs map[string]*ifDoc,
+	ifs ifStatsPollerInterfaceVec, t string) {
+	for i := range ifs {
+		psi := &ifs[i]
+		if psi.name == "" {
+			continue
+		}
+		doc, found := docs[psi.name]
+		if !found {
+			doc = &ifDoc{
+				Time:     t,
+				Counters: make(map[string]uint64),
+			}
+			if c, found := p.mk1.prevHwIfConfig[psi.name]; found {
+				doc.Config = &ifDocConfig{
+					Speed:    c.speed,
+					Media:    c.media,
+					Fec:      c.fec,
+					Mtu:      c.mtu,
+					Loopback: c.loopback,
+					Autoneg:  c.autoneg,
+					Class:    c.class,
+					Admin:    c.admin,
+					Link:     c.link,
+				}
+			}
+			docs[psi.name] = doc
+		}
+		for counter, c := range psi.lastValues {
+			if p.filter.allows(counter) {
+				doc.Counters[xCounter(counter)] =
+					psi.relative(counter, c.value)
+			}
+		}
+		for name, rate := range psi.lastRates {
+			if doc.Rates == nil {
+				doc.Rates = make(map[string]json.Number)
+			}
+			doc.Rates[name] = json.Number(rate)
+		}
+	}
+}
+
+// Publish vnet.IF.json for each polled interface.
+func (p *ifStatsPoller) pubIfDocs(start time.Time) {
+	docs := make(map[string]*ifDoc)
+	t := start.Format(time.RFC3339Nano)
+	p.mu.Lock()
+	p.addIfDocs(docs, p.hwInterfaces, t)
+	p.addIfDocs(docs, p.swInterfaces, t)
+	p.mu.Unlock()
+	for ifname, doc := range docs {
+		b, err := json.Marshal(doc)
+		if err != nil {
+			dbgVnetd.Log(ifname, err)
+			continue
+		}
+		p.pubq.send(fmt.Sprint(ifname, ".json: ", string(b)))
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/xeth"
+)
+
+const (
+	influxMeasurement = "vnet_interface"
+	influxUdpPayload  = 1400
+	influxTimeout     = 5 * time.Second
+)
+
+// Export changed interface counters in InfluxDB line protocol, one line
+// per interface per poll. Writes happen in goinflux so a slow endpoint
+// never stalls the poller.
+type influxExporter struct {
+	// *influxEndpoint, swapped by the event loop without locking
+	cur    atomic.Value
+	ch     chan []byte
+	errors uint64
+	// Pending fields of current poll indexed by interface name.
+	fields map[string][]string
+}
+
+type influxEndpoint struct {
+	spec string
+	w    io.WriteCloser
+}
+
+// Parse export specs of the form,
+//
+//	udp:HOST:PORT
+//	http://HOST:PORT/write?db=DB
+//	file:PATH
+func newInfluxWriter(spec string) (io.WriteCloser, error) {
+	switch {
+	case strings.HasPrefix(spec, "udp:"):
+		conn, err := net.Dial("udp", strings.TrimPrefix(spec, "udp:"))
+		if err != nil {
+			return nil, err
+		}
+		return &influxUdp{conn}, nil
+	case strings.HasPrefix(spec, "http://"),
+		strings.HasPrefix(spec, "https://"):
+		return &influxHttp{
+			url:    spec,
+			client: &http.Client{Timeout: influxTimeout},
+		}, nil
+	case strings.HasPrefix(spec, "file:"):
+		return os.OpenFile(strings.TrimPrefix(spec, "file:"),
+			os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	}
+	return nil, fmt.Errorf("%s: unknown influx endpoint", spec)
+}
+
+func (x *influxExporter) endpoint() *influxEndpoint {
+	ep, _ := x.cur.Load().(*influxEndpoint)
+	return ep
+}
+
+// Replace the endpoint, "" for none. The old one is closed in the
+// background; files and sockets are safe to close under a Write that
+// goinflux may have in progress.
+func (x *influxExporter) set(spec string) error {
+	ep := &influxEndpoint{spec: spec}
+	if spec != "" {
+		var err error
+		if ep.w, err = newInfluxWriter(spec); err != nil {
+			return err
+		}
+	}
+	old := x.endpoint()
+	x.cur.Store(ep)
+	if old != nil && old.w != nil {
+		go old.w.Close()
+	}
+	return nil
+}
+
+func (x *influxExporter) enabled() bool {
+	ep := x.endpoint()
+	return ep != nil && ep.w != nil
+}
+
+// Add a changed counter to this poll's line for ifname.
+func (x *influxExporter) add(ifname, counter string, value uint64) {
+	if x.fields == nil {
+		x.fields = make(map[string][]string)
+	}
+	x.fields[ifname] = append(x.fields[ifname],
+		fmt.Sprintf("%s=%di", influxEscape(counter), value))
+}
+
+// Queue the lines of this poll then reset the pending fields.
+func (x *influxExporter) flush(t time.Time) {
+	if len(x.fields) == 0 {
+		return
+	}
+	ifnames := make([]string, 0, len(x.fields))
+	for ifname := range x.fields {
+		ifnames = append(ifnames, ifname)
+	}
+	sort.Strings(ifnames)
+	buf := new(bytes.Buffer)
+	for _, ifname := range ifnames {
+		fmt.Fprint(buf, influxMeasurement, ",ifname=",
+			influxEscape(ifname))
+		if entry, found := vnet.Ports.GetPortByName(ifname); found {
+			fmt.Fprint(buf, ",portindex=", entry.Portindex)
+		}
+		if entry := xeth.Interface.Named(ifname); entry != nil {
+			fmt.Fprint(buf, ",devtype=", influxEscape(entry.DevType.String()))
+		}
+		fmt.Fprint(buf, " ", strings.Join(x.fields[ifname], ","), " ",
+			t.UnixNano(), "\n")
+	}
+	x.fields = nil
+	select {
+	case x.ch <- buf.Bytes():
+	default:
+		atomic.AddUint64(&x.errors, 1)
+	}
+}
+
+func (mk1 *Mk1) goinflux() {
+	x := &mk1.influx
+	for b := range x.ch {
+		if ep := x.endpoint(); ep != nil && ep.w != nil {
+			if _, err := ep.w.Write(b); err != nil {
+				atomic.AddUint64(&x.errors, 1)
+			}
+		}
+	}
+}
+
+var influxEscapes = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// Escape tag keys, tag values and field keys.
+func influxEscape(s string) string {
+	return influxEscapes.Replace(s)
+}
+
+// Split a batch of lines into datagrams that won't fragment.
+type influxUdp struct {
+	net.Conn
+}
+
+func (u *influxUdp) Write(b []byte) (n int, err error) {
+	for len(b) > 0 {
+		i := len(b)
+		if i > influxUdpPayload {
+			i = bytes.LastIndexByte(b[:influxUdpPayload], '\n') + 1
+			if i == 0 {
+				i = bytes.IndexByte(b, '\n') + 1
+			}
+			if i == 0 {
+				i = len(b)
+			}
+		}
+		w, err := u.Conn.Write(b[:i])
+		n += w
+		if err != nil {
+			return n, err
+		}
+		b = b[i:]
+	}
+	return
+}
+
+type influxHttp struct {
+	url    string
+	client *http.Client
+}
+
+func (h *influxHttp) Write(b []byte) (int, error) {
+	resp, err := h.client.Post(h.url, "text/plain", bytes.NewReader(b))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return 0, fmt.Errorf("%s: %s", h.url, resp.Status)
+	}
+	return len(b), nil
+}
+
+func (*influxHttp) Close() error { return nil }
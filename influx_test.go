@@ -0,0 +1,97 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestInfluxEscape(t *testing.T) {
+	for _, x := range []struct{ in, out string }{
+		{"rx-bytes", "rx-bytes"},
+		{"a,b", `a\,b`},
+		{"k=v", `k\=v`},
+		{"eth 1", `eth\ 1`},
+		{"a, =b", `a\,\ \=b`},
+	} {
+		if got := influxEscape(x.in); got != x.out {
+			t.Errorf("influxEscape(%q) = %q, want %q", x.in, got, x.out)
+		}
+	}
+}
+
+// Records each datagram.
+type testDatagramConn struct {
+	net.Conn
+	datagrams [][]byte
+}
+
+func (c *testDatagramConn) Write(b []byte) (int, error) {
+	c.datagrams = append(c.datagrams, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func TestInfluxUdpWrite(t *testing.T) {
+	line := func(n int) string {
+		return strings.Repeat("x", n-1) + "\n"
+	}
+	for _, x := range []struct {
+		name  string
+		in    string
+		sizes []int
+	}{
+		{"one", line(100), []int{100}},
+		{"packed", line(700) + line(700), []int{1400}},
+		{"split", line(700) + line(701), []int{700, 701}},
+		{"lines", line(600) + line(600) + line(600), []int{1200, 600}},
+		{"oversize", line(2000) + line(10), []int{2000, 10}},
+		{"unterminated", strings.Repeat("y", 1500), []int{1500}},
+	} {
+		c := &testDatagramConn{}
+		u := &influxUdp{c}
+		n, err := u.Write([]byte(x.in))
+		if err != nil || n != len(x.in) {
+			t.Errorf("%s: Write() = %d, %v", x.name, n, err)
+		}
+		var sizes []int
+		for _, d := range c.datagrams {
+			sizes = append(sizes, len(d))
+		}
+		if len(sizes) != len(x.sizes) {
+			t.Errorf("%s: datagrams %v, want %v", x.name, sizes, x.sizes)
+			continue
+		}
+		for i := range sizes {
+			if sizes[i] != x.sizes[i] {
+				t.Errorf("%s: datagrams %v, want %v",
+					x.name, sizes, x.sizes)
+				break
+			}
+		}
+		if got := bytes.Join(c.datagrams, nil); string(got) != x.in {
+			t.Errorf("%s: datagrams don't rejoin", x.name)
+		}
+	}
+}
+
+func TestInfluxSet(t *testing.T) {
+	var x influxExporter
+	if x.enabled() {
+		t.Fatal("enabled before set")
+	}
+	if err := x.set("bogus:"); err == nil || x.enabled() {
+		t.Errorf("set(bogus:) = %v, enabled %v", err, x.enabled())
+	}
+	if err := x.set("http://localhost:8086/write?db=vnet"); err != nil ||
+		!x.enabled() {
+		t.Errorf("set(http) = %v, enabled %v", err, x.enabled())
+	}
+	if err := x.set(""); err != nil || x.enabled() {
+		t.Errorf("set() = %v, enabled %v", err, x.enabled())
+	}
+}
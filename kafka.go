@@ -0,0 +1,273 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	defaultKafkaTopic = "hf-counters"
+	kafkaClientId     = "vnet-platina-mk1"
+	kafkaTimeout      = 5 * time.Second
+)
+
+// A minimal Kafka producer that batches records into one ProduceRequest
+// v3 (record batch v2; Kafka 0.11 through 4.x) with acks=1 to partition
+// 0 of a single broker. There's no metadata lookup so the broker must
+// lead that partition; that is always true of the single node brokers
+// these counters are meant for.
+type kafkaProducer struct {
+	broker        string
+	topic         string
+	conn          net.Conn
+	r             *bufio.Reader
+	correlationId int32
+	buf           bytes.Buffer
+	// pending records
+	batch []*hfRecord
+}
+
+func newKafkaProducer(arg string) (*kafkaProducer, error) {
+	p := &kafkaProducer{broker: arg, topic: defaultKafkaTopic}
+	if i := strings.Index(arg, "/"); i >= 0 {
+		p.broker, p.topic = arg[:i], arg[i+1:]
+	}
+	if _, _, err := net.SplitHostPort(p.broker); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *kafkaProducer) String() string {
+	return "kafka:" + p.broker + "/" + p.topic
+}
+
+func (p *kafkaProducer) Close() error {
+	p.batch = nil
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn = nil
+	return err
+}
+
+// Buffer the record for the next Flush.
+func (p *kafkaProducer) Write(r *hfRecord) error {
+	if len(p.batch) >= hfBatchRecords {
+		return fmt.Errorf("kafka: batch full")
+	}
+	p.batch = append(p.batch, r)
+	return nil
+}
+
+// Produce the buffered records; they are dropped on error.
+func (p *kafkaProducer) Flush() (n int, err error) {
+	n = len(p.batch)
+	if n == 0 {
+		return
+	}
+	defer func() { p.batch = p.batch[:0] }()
+	if p.conn == nil {
+		conn, err := net.DialTimeout("tcp", p.broker, kafkaTimeout)
+		if err != nil {
+			return n, err
+		}
+		p.conn = conn
+		p.r = bufio.NewReader(conn)
+	}
+	if err = p.produce(p.batch); err != nil {
+		p.conn.Close()
+		p.conn = nil
+	}
+	return
+}
+
+func (p *kafkaProducer) produce(records []*hfRecord) error {
+	p.correlationId++
+	b := &p.buf
+	b.Reset()
+	// size is filled in below
+	kafkaPut(b, int32(0))
+	// request header: api key, version, correlation id, client id
+	kafkaPut(b, int16(0))
+	kafkaPut(b, int16(3))
+	kafkaPut(b, p.correlationId)
+	kafkaPutString(b, kafkaClientId)
+	// null transactional id, acks, timeout and one topic of one partition
+	kafkaPut(b, int16(-1))
+	kafkaPut(b, int16(1))
+	kafkaPut(b, int32(kafkaTimeout/time.Millisecond))
+	kafkaPut(b, int32(1))
+	kafkaPutString(b, p.topic)
+	kafkaPut(b, int32(1))
+	kafkaPut(b, int32(0))
+	kafkaPutBytes(b, kafkaRecordBatch(records))
+	req := b.Bytes()
+	binary.BigEndian.PutUint32(req, uint32(len(req)-4))
+
+	p.conn.SetDeadline(time.Now().Add(kafkaTimeout))
+	if _, err := p.conn.Write(req); err != nil {
+		return err
+	}
+	return p.response()
+}
+
+var kafkaCrc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// Record batch v2 of records keyed by interface name.
+func kafkaRecordBatch(records []*hfRecord) []byte {
+	first, last := records[0].Msec, records[0].Msec
+	for _, r := range records {
+		if r.Msec < first {
+			first = r.Msec
+		}
+		if r.Msec > last {
+			last = r.Msec
+		}
+	}
+	b := new(bytes.Buffer)
+	// base offset, length (filled in below), partition leader epoch,
+	// magic and crc (filled in below)
+	kafkaPut(b, int64(0))
+	kafkaPut(b, int32(0))
+	kafkaPut(b, int32(-1))
+	kafkaPut(b, int8(2))
+	kafkaPut(b, uint32(0))
+	// attributes, last offset delta, first and max timestamp, no
+	// producer id, epoch or sequence, then the records
+	kafkaPut(b, int16(0))
+	kafkaPut(b, int32(len(records)-1))
+	kafkaPut(b, first)
+	kafkaPut(b, last)
+	kafkaPut(b, int64(-1))
+	kafkaPut(b, int16(-1))
+	kafkaPut(b, int32(-1))
+	kafkaPut(b, int32(len(records)))
+	rb := new(bytes.Buffer)
+	for i, r := range records {
+		rb.Reset()
+		rb.WriteByte(0)
+		kafkaPutVarint(rb, r.Msec-first)
+		kafkaPutVarint(rb, int64(i))
+		kafkaPutVarint(rb, int64(len(r.Ifname)))
+		rb.WriteString(r.Ifname)
+		value := r.String()
+		kafkaPutVarint(rb, int64(len(value)))
+		rb.WriteString(value)
+		// no headers
+		kafkaPutVarint(rb, 0)
+		kafkaPutVarint(b, int64(rb.Len()))
+		b.Write(rb.Bytes())
+	}
+	batch := b.Bytes()
+	binary.BigEndian.PutUint32(batch[8:], uint32(len(batch)-12))
+	binary.BigEndian.PutUint32(batch[17:],
+		crc32.Checksum(batch[21:], kafkaCrc32c))
+	return batch
+}
+
+func (p *kafkaProducer) response() error {
+	var size, correlationId, ntopics int32
+	if err := kafkaGet(p.r, &size, &correlationId); err != nil {
+		return err
+	}
+	if correlationId != p.correlationId {
+		return fmt.Errorf("kafka: correlation id %d, expected %d",
+			correlationId, p.correlationId)
+	}
+	if err := kafkaGet(p.r, &ntopics); err != nil {
+		return err
+	}
+	for ; ntopics > 0; ntopics-- {
+		var (
+			topic       string
+			npartitions int32
+		)
+		if err := kafkaGetString(p.r, &topic); err != nil {
+			return err
+		}
+		if err := kafkaGet(p.r, &npartitions); err != nil {
+			return err
+		}
+		for ; npartitions > 0; npartitions-- {
+			var (
+				partition          int32
+				code               int16
+				offset, appendMsec int64
+			)
+			err := kafkaGet(p.r, &partition, &code, &offset,
+				&appendMsec)
+			if err != nil {
+				return err
+			}
+			if code != 0 {
+				return fmt.Errorf("kafka: %s[%d] error code %d",
+					topic, partition, code)
+			}
+		}
+	}
+	var throttleMsec int32
+	return kafkaGet(p.r, &throttleMsec)
+}
+
+func kafkaPut(w io.Writer, v interface{}) {
+	binary.Write(w, binary.BigEndian, v)
+}
+
+func kafkaPutString(b *bytes.Buffer, s string) {
+	kafkaPut(b, int16(len(s)))
+	b.WriteString(s)
+}
+
+func kafkaPutBytes(b *bytes.Buffer, v []byte) {
+	if v == nil {
+		kafkaPut(b, int32(-1))
+		return
+	}
+	kafkaPut(b, int32(len(v)))
+	b.Write(v)
+}
+
+// Zigzag varint of record fields.
+func kafkaPutVarint(b *bytes.Buffer, v int64) {
+	var buf [binary.MaxVarintLen64]byte
+	b.Write(buf[:binary.PutVarint(buf[:], v)])
+}
+
+func kafkaGet(r io.Reader, vs ...interface{}) error {
+	for _, v := range vs {
+		if err := binary.Read(r, binary.BigEndian, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func kafkaGetString(r io.Reader, s *string) error {
+	var n int16
+	if err := kafkaGet(r, &n); err != nil {
+		return err
+	}
+	if n < 0 {
+		*s = ""
+		return nil
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return err
+	}
+	*s = string(b)
+	return nil
+}
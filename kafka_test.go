@@ -0,0 +1,249 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// A produce request as decoded by the stand-in broker.
+type kafkaTestRequest struct {
+	apiKey, version int16
+	correlationId   int32
+	clientId        string
+	acks            int16
+	topic           string
+	partition       int32
+	keys, values    []string
+}
+
+// Stand-in broker that decodes each request, hands it to check, and
+// answers with the error code it returns.
+func kafkaTestBroker(t *testing.T,
+	check func(*kafkaTestRequest) int16) (addr string, stop func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			var size int32
+			if kafkaGet(r, &size) != nil {
+				return
+			}
+			body := make([]byte, size)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return
+			}
+			req, err := kafkaTestDecode(body)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			b := new(bytes.Buffer)
+			kafkaPut(b, int32(0))
+			kafkaPut(b, req.correlationId)
+			kafkaPut(b, int32(1))
+			kafkaPutString(b, req.topic)
+			kafkaPut(b, int32(1))
+			kafkaPut(b, req.partition)
+			kafkaPut(b, check(req))
+			kafkaPut(b, int64(42))
+			kafkaPut(b, int64(-1))
+			kafkaPut(b, int32(0))
+			resp := b.Bytes()
+			binary.BigEndian.PutUint32(resp, uint32(len(resp)-4))
+			conn.Write(resp)
+		}
+	}()
+	return ln.Addr().String(), func() { ln.Close() }
+}
+
+func kafkaTestDecode(body []byte) (*kafkaTestRequest, error) {
+	req := new(kafkaTestRequest)
+	r := bytes.NewReader(body)
+	var (
+		transactionalId       int16
+		timeout, ntopics, nps int32
+		batchSize             int32
+	)
+	if err := kafkaGet(r, &req.apiKey, &req.version,
+		&req.correlationId); err != nil {
+		return nil, err
+	}
+	if err := kafkaGetString(r, &req.clientId); err != nil {
+		return nil, err
+	}
+	if err := kafkaGet(r, &transactionalId, &req.acks, &timeout,
+		&ntopics); err != nil {
+		return nil, err
+	}
+	if err := kafkaGetString(r, &req.topic); err != nil {
+		return nil, err
+	}
+	if err := kafkaGet(r, &nps, &req.partition, &batchSize); err != nil {
+		return nil, err
+	}
+	if transactionalId != -1 || ntopics != 1 || nps != 1 {
+		return nil, fmt.Errorf("transactional id %d, %d topics, %d partitions",
+			transactionalId, ntopics, nps)
+	}
+	batch := make([]byte, batchSize)
+	if _, err := io.ReadFull(r, batch); err != nil {
+		return nil, err
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%d trailing bytes", r.Len())
+	}
+	if magic := batch[16]; magic != 2 {
+		return nil, fmt.Errorf("magic %d", magic)
+	}
+	if n := binary.BigEndian.Uint32(batch[8:]); int(n) != len(batch)-12 {
+		return nil, fmt.Errorf("batch length %d of %d", n, len(batch))
+	}
+	crc := binary.BigEndian.Uint32(batch[17:])
+	if want := crc32.Checksum(batch[21:],
+		crc32.MakeTable(crc32.Castagnoli)); crc != want {
+		return nil, fmt.Errorf("crc %#x, want %#x", crc, want)
+	}
+	nrecords := int(binary.BigEndian.Uint32(batch[57:]))
+	rr := bytes.NewReader(batch[61:])
+	for i := 0; i < nrecords; i++ {
+		var fields [4]int64
+		length, err := binary.ReadVarint(rr)
+		if err != nil {
+			return nil, err
+		}
+		start := rr.Len()
+		rr.ReadByte()
+		// timestamp and offset deltas
+		for j := 0; j < 2; j++ {
+			if fields[j], err = binary.ReadVarint(rr); err != nil {
+				return nil, err
+			}
+		}
+		if fields[1] != int64(i) {
+			return nil, fmt.Errorf("record %d offset delta %d", i, fields[1])
+		}
+		var kv [2]string
+		for j := range kv {
+			n, err := binary.ReadVarint(rr)
+			if err != nil {
+				return nil, err
+			}
+			b := make([]byte, n)
+			if _, err = io.ReadFull(rr, b); err != nil {
+				return nil, err
+			}
+			kv[j] = string(b)
+		}
+		if nheaders, _ := binary.ReadVarint(rr); nheaders != 0 {
+			return nil, fmt.Errorf("%d headers", nheaders)
+		}
+		if int64(start-rr.Len()) != length {
+			return nil, fmt.Errorf("record %d length %d, read %d",
+				i, length, start-rr.Len())
+		}
+		req.keys = append(req.keys, kv[0])
+		req.values = append(req.values, kv[1])
+	}
+	return req, nil
+}
+
+func TestKafkaProduce(t *testing.T) {
+	var (
+		mu  sync.Mutex
+		got []*kafkaTestRequest
+	)
+	addr, stop := kafkaTestBroker(t, func(req *kafkaTestRequest) int16 {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, req)
+		if len(got) == 2 {
+			// NOT_LEADER_OR_FOLLOWER
+			return 6
+		}
+		return 0
+	})
+	defer stop()
+	p, err := newKafkaProducer(addr + "/counters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	records := []*hfRecord{
+		{Host: "mk1", Msec: 1000, Ifname: "xeth1", Values: "1,2"},
+		{Host: "mk1", Msec: 1002, Ifname: "xeth2", Values: "3,4"},
+	}
+	for _, r := range records {
+		if err = p.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := p.Flush(); n != 2 || err != nil {
+		t.Fatalf("Flush() = %d, %v; want 2, nil", n, err)
+	}
+	if n, err := p.Flush(); n != 0 || err != nil {
+		t.Fatalf("empty Flush() = %d, %v; want 0, nil", n, err)
+	}
+	mu.Lock()
+	reqs := append([]*kafkaTestRequest(nil), got...)
+	mu.Unlock()
+	if len(reqs) != 1 {
+		t.Fatalf("%d requests, want 1", len(reqs))
+	}
+	req := reqs[0]
+	if req.apiKey != 0 || req.version != 3 || req.acks != 1 ||
+		req.clientId != kafkaClientId || req.topic != "counters" ||
+		req.partition != 0 {
+		t.Errorf("request %+v", req)
+	}
+	want := []string{"mk1,1000,xeth1,1,2", "mk1,1002,xeth2,3,4"}
+	if strings.Join(req.keys, " ") != "xeth1 xeth2" ||
+		strings.Join(req.values, " ") != strings.Join(want, " ") {
+		t.Errorf("keys %q values %q", req.keys, req.values)
+	}
+
+	p.Write(records[0])
+	if n, err := p.Flush(); n != 1 || err == nil {
+		t.Errorf("Flush() = %d, %v; want 1, error code 6", n, err)
+	}
+	if p.conn != nil {
+		t.Error("connection kept after error")
+	}
+}
+
+func TestNewKafkaProducer(t *testing.T) {
+	for _, x := range []struct {
+		arg, broker, topic string
+		ok                 bool
+	}{
+		{"localhost:9092", "localhost:9092", defaultKafkaTopic, true},
+		{"10.0.0.1:9092/hf", "10.0.0.1:9092", "hf", true},
+		{"localhost", "", "", false},
+	} {
+		p, err := newKafkaProducer(x.arg)
+		if (err == nil) != x.ok {
+			t.Errorf("%s: %v", x.arg, err)
+		} else if x.ok && (p.broker != x.broker || p.topic != x.topic) {
+			t.Errorf("%s: broker %s topic %s", x.arg, p.broker, p.topic)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/platinasystems/elib/parse"
+	"github.com/platinasystems/vnet"
+)
+
+// "IF.loopback" values. Remote loopback, where the port returns what
+// it receives from the link partner, isn't among vnet's IfLoopbackType
+// for Devicer.SetLoopback and the fe1 driver has no other hook for it,
+// so it's refused.
+var loopbackTypes = map[string]vnet.IfLoopbackType{
+	"none": vnet.IfLoopbackNone,
+	"mac":  vnet.IfLoopbackMac,
+	"phy":  vnet.IfLoopbackPhy,
+}
+
+func (mk1 *Mk1) setLoopback(hi vnet.Hi, mode string) error {
+	v := &mk1.vnet
+	lt, found := loopbackTypes[mode]
+	if !found {
+		if mode == "remote" {
+			return fmt.Errorf("remote loopback not supported by vnet")
+		}
+		return fmt.Errorf("%s: expected none, mac, phy or remote", mode)
+	}
+	if err := v.HwIfer(hi).SetLoopback(lt); err != nil {
+		return err
+	}
+	mk1.hwIfConfig(hi.Name(v)).loopback = mode
+	if mk1.hw_is_ok(hi) {
+		mk1.publish_link(hi, v.HwIf(hi).IsLinkUp())
+	}
+	return nil
+}
+
+// Whether IF.link is that of a looped port rather than a production
+// link; published as IF.link-loopback so that IF.link stays boolean.
+func (c *hwIfConfig) linkLoopback() string {
+	return fmt.Sprint(parse.Enable(c.loopback != "" && c.loopback != "none"))
+}
+
+// The hardware of a re-provisioned port comes back without loopback, so
+// its mode is re-applied once the event loop is through provisioning;
+// should that fail, the mode is reset to none.
+type loopbackEvent struct {
+	vnet.Event
+	mk1    *Mk1
+	ifname string
+}
+
+func (e *loopbackEvent) String() string {
+	return fmt.Sprintf("re-apply %s loopback", e.ifname)
+}
+
+func (e *loopbackEvent) EventAction() {
+	mk1 := e.mk1
+	v := &mk1.vnet
+	hi, found := v.HwIfByName(e.ifname)
+	if !found || !hi.IsProvisioned(v) {
+		return
+	}
+	c := mk1.hwIfConfig(e.ifname)
+	mode := c.loopback
+	if err := v.HwIfer(hi).SetLoopback(loopbackTypes[mode]); err != nil {
+		dbgVnetd.Log(e, mode, err)
+		mode = "none"
+	}
+	if mode != c.loopback {
+		c.loopback = mode
+		mk1.poller.pubq.send(fmt.Sprint(e.ifname, ".loopback: ", mode))
+	}
+	if mk1.hw_is_ok(hi) {
+		mk1.publish_link(hi, v.HwIf(hi).IsLinkUp())
+	}
+}
+
+func (mk1 *Mk1) hw_if_provision(v *vnet.Vnet, hi vnet.Hi, isProvisioned bool) error {
+	ifname := hi.Name(v)
+	c, found := mk1.prevHwIfConfig[ifname]
+	if isProvisioned && found && c.loopback != "" && c.loopback != "none" {
+		v.SignalEvent(&loopbackEvent{mk1: mk1, ifname: ifname})
+	}
+	return nil
+}
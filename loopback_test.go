@@ -0,0 +1,38 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLinkLoopback(t *testing.T) {
+	for _, x := range []struct{ loopback, out string }{
+		{"", "false"},
+		{"none", "false"},
+		{"mac", "true"},
+		{"phy", "true"},
+	} {
+		c := &hwIfConfig{loopback: x.loopback}
+		if got := c.linkLoopback(); got != x.out {
+			t.Errorf("loopback %q: link-loopback %s, want %s",
+				x.loopback, got, x.out)
+		}
+	}
+}
+
+func TestSetLoopbackRefused(t *testing.T) {
+	mk1 := new(Mk1)
+	for _, x := range []struct{ mode, err string }{
+		{"remote", "not supported"},
+		{"far", "expected none, mac, phy or remote"},
+	} {
+		err := mk1.setLoopback(0, x.mode)
+		if err == nil || !strings.Contains(err.Error(), x.err) {
+			t.Errorf("setLoopback(%q) = %v, want %q", x.mode, err, x.err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/platinasystems/vnet"
+)
+
+// Serve the counters cached by ifStatsPoller in Prometheus text format.
+// Scrapes never touch the hardware; they only see what the last poll saw.
+type metricsServer struct {
+	addr string
+	srv  *http.Server
+}
+
+func (m *metricsServer) close() {
+	if m.srv != nil {
+		m.srv.Close()
+		m.srv = nil
+	}
+	m.addr = ""
+}
+
+// Listen on addr, e.g. "127.0.0.1:9101"; an empty addr disables the exporter.
+func (mk1 *Mk1) initMetrics(addr string) error {
+	m := &mk1.metrics
+	m.close()
+	if addr == "" {
+		return nil
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", mk1.serveMetrics)
+	m.addr = addr
+	m.srv = &http.Server{Handler: mux}
+	go m.srv.Serve(ln)
+	return nil
+}
+
+// Counter values copied from the poller's cache for a scrape.
+type metricSample struct {
+	ifname, counter string
+	value           uint64
+}
+
+// Copy the cached values then write them without holding the poller's
+// lock so that a slow scraper can't stall polling.
+func (mk1 *Mk1) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	p := &mk1.poller
+	p.mu.Lock()
+	hw := metricSamples(p.hwInterfaces)
+	sw := metricSamples(p.swInterfaces)
+	p.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	bw := bufio.NewWriter(w)
+	defer bw.Flush()
+	writeMetricFamily(bw, "vnet_hw_interface_counter",
+		"hardware interface counters", hw)
+	writeMetricFamily(bw, "vnet_sw_interface_counter",
+		"software interface counters", sw)
+}
+
+func metricSamples(ifs ifStatsPollerInterfaceVec) (samples []metricSample) {
+	for i := range ifs {
+		psi := &ifs[i]
+		if psi.name == "" {
+			continue
+		}
+		for counter, c := range psi.lastValues {
+			samples = append(samples,
+				metricSample{psi.name, counter, c.value})
+		}
+	}
+	return
+}
+
+func writeMetricFamily(w *bufio.Writer, metric, help string,
+	samples []metricSample) {
+	fmt.Fprintf(w, "# HELP %s %s\n", metric, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", metric)
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].ifname != samples[j].ifname {
+			return samples[i].ifname < samples[j].ifname
+		}
+		return samples[i].counter < samples[j].counter
+	})
+	var portindex, subport string
+	for i, x := range samples {
+		if i == 0 || x.ifname != samples[i-1].ifname {
+			portindex, subport = "", ""
+			if entry, found := vnet.Ports.GetPortByName(x.ifname); found {
+				portindex = fmt.Sprint(entry.Portindex)
+				subport = fmt.Sprint(entry.Subportindex)
+			}
+		}
+		fmt.Fprintf(w, "%s{interface=\"%s\",counter=\"%s\",portindex=\"%s\",subport=\"%s\"} %d\n",
+			metric, metricLabel(x.ifname), metricLabel(xCounter(x.counter)),
+			portindex, subport, x.value)
+	}
+}
+
+var metricLabelEscapes = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Escape a label value per the Prometheus text exposition format.
+func metricLabel(s string) string {
+	return metricLabelEscapes.Replace(s)
+}
@@ -0,0 +1,42 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func TestMetricLabel(t *testing.T) {
+	for _, x := range []struct{ in, out string }{
+		{"xeth1", "xeth1"},
+		{`a\b`, `a\\b`},
+		{`say "hi"`, `say \"hi\"`},
+		{"two\nlines", `two\nlines`},
+	} {
+		if got := metricLabel(x.in); got != x.out {
+			t.Errorf("metricLabel(%q) = %q, want %q", x.in, got, x.out)
+		}
+	}
+}
+
+func TestWriteMetricFamilyOrder(t *testing.T) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	writeMetricFamily(w, "m", "help", []metricSample{
+		{"xeth2", "rx-packets", 2},
+		{"xeth1", "tx-packets", 3},
+		{"xeth1", "rx-packets", 1},
+	})
+	w.Flush()
+	want := "# HELP m help\n# TYPE m counter\n" +
+		`m{interface="xeth1",counter="rx-packets",portindex="",subport=""} 1` + "\n" +
+		`m{interface="xeth1",counter="tx-packets",portindex="",subport=""} 3` + "\n" +
+		`m{interface="xeth2",counter="rx-packets",portindex="",subport=""} 2` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
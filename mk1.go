@@ -13,6 +13,7 @@ import (
 	"os/signal"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 	"unsafe"
@@ -41,20 +42,50 @@ type Mk1 struct {
 	poller          ifStatsPoller
 	fastPoller      fastIfStatsPoller
 	unresolvedArper unresolvedArper
+	metrics         metricsServer
+	influx          influxExporter
 	pub             *publisher.Publisher
-	// producer	*kafka.Producer
+	pubStats        pubStats
+	subscribers     subscribers
+	hfSinker        hfSinker
 
 	// Enable publish of Non-unix (e.g. non-tuntap) interfaces.
 	// This will include all vnet interfaces.
 	unixInterfacesOnly bool
 
 	prevHwIfConfig map[string]*hwIfConfig
+	// DriverName of xeth port hw interfaces; see portDriver.
+	xethPortDriver string
 }
 
 type hwIfConfig struct {
-	speed string
-	media string
-	fec   string
+	speed    string
+	media    string
+	fec      string
+	mtu      string
+	loopback string
+	autoneg  string
+	pvid     string
+	class    string
+	admin    string
+	link     string
+
+	advertise      advertisement
+	fixedSpeed     vnet.Bandwidth
+	autonegSpeed   string
+	autonegPartner string
+}
+
+func (mk1 *Mk1) hwIfConfig(ifname string) *hwIfConfig {
+	if mk1.prevHwIfConfig == nil {
+		mk1.prevHwIfConfig = make(map[string]*hwIfConfig)
+	}
+	entry, found := mk1.prevHwIfConfig[ifname]
+	if !found {
+		entry = new(hwIfConfig)
+		mk1.prevHwIfConfig[ifname] = entry
+	}
+	return entry
 }
 
 func mk1Main() error {
@@ -94,15 +125,23 @@ func mk1Main() error {
 	}
 	defer sock.Close()
 
-	mk1.poller.pubch = make(chan string, chanDepth)
-	defer close(mk1.poller.pubch)
+	if err = mk1.subscribers.listen(subscribeSocket); err != nil {
+		return err
+	}
+	defer mk1.subscribers.close()
+
+	mk1.poller.pubq.init(chanDepth)
+	defer mk1.poller.pubq.close()
 	go mk1.gopublish()
 
-	if false {
-		mk1.fastPoller.pubch = make(chan string)
-		defer close(mk1.fastPoller.pubch)
-		go mk1.gopublishHf()
-	}
+	mk1.fastPoller.pubch = make(chan *hfRecord, chanDepth)
+	mk1.hfSinker.retire = make(chan struct{}, 1)
+	defer close(mk1.fastPoller.pubch)
+	go mk1.gopublishHf()
+
+	mk1.influx.ch = make(chan []byte, 64)
+	defer close(mk1.influx.ch)
+	go mk1.goinflux()
 
 	err = redis.Assign(redis.DefaultHash+":vnet.", "vnetd", "Mk1")
 	if err != nil {
@@ -178,6 +217,7 @@ func mk1Main() error {
 
 	mk1.vnet.RegisterHwIfAddDelHook(mk1.hw_if_add_del)
 	mk1.vnet.RegisterHwIfLinkUpDownHook(mk1.hw_if_link_up_down)
+	mk1.vnet.RegisterHwIfProvisionHook(mk1.hw_if_provision)
 	mk1.vnet.RegisterSwIfAddDelHook(mk1.sw_if_add_del)
 	mk1.vnet.RegisterSwIfAdminUpDownHook(mk1.sw_if_admin_up_down)
 
@@ -247,12 +287,23 @@ func (mk1 *Mk1) init() {
 	mk1.pubHwIfConfig()
 	mk1.set("ready", "true", true)
 
-	mk1.poller.pubch <- fmt.Sprint("poll.max-channel-depth: ", chanDepth)
-	mk1.poller.pubch <- fmt.Sprint("pollInterval: ", defaultPollInterval)
-	mk1.poller.pubch <- fmt.Sprint("pollInterval.msec: ",
-		defaultFastPollIntervalMilliSec)
-	mk1.poller.pubch <- fmt.Sprint("kafka-broker: ", "")
-	mk1.poller.pubch <- fmt.Sprint("unresolved-arpInterval: ", defaultUnresolvedArpInterval)
+	mk1.poller.pubq.send(fmt.Sprint("poll.max-channel-depth: ", chanDepth))
+	mk1.poller.pubq.send(fmt.Sprint("pollInterval: ", defaultPollInterval))
+	mk1.poller.pubq.send(fmt.Sprint("pollInterval.msec: ",
+		defaultFastPollIntervalMilliSec))
+	mk1.poller.pubq.send(fmt.Sprint("kafka-broker: ", ""))
+	mk1.poller.pubq.send(fmt.Sprint("hf-sink: ", ""))
+	mk1.poller.pubq.send(fmt.Sprint("hf-interfaces: ", mk1.fastPoller.interfaces))
+	mk1.poller.pubq.send(fmt.Sprint("hf-counters: ", mk1.fastPoller.counters))
+	mk1.poller.pubq.send(fmt.Sprint("metrics-listen: ", ""))
+	mk1.poller.pubq.send(fmt.Sprint("influx: ", ""))
+	mk1.poller.pubq.send(fmt.Sprint("unresolved-arpInterval: ", defaultUnresolvedArpInterval))
+	mk1.poller.initAlarms()
+	mk1.poller.initCounterGroups()
+	mk1.poller.startCounterGroups()
+	mk1.poller.initFilter()
+	mk1.poller.pubq.send(fmt.Sprint("poll.json: ", parse.Enable(false)))
+	go mk1.gomtu()
 }
 
 func (mk1 *Mk1) newEvent() interface{} {
@@ -260,6 +311,7 @@ func (mk1 *Mk1) newEvent() interface{} {
 		mk1:      mk1,
 		err:      make(chan error, 1),
 		newValue: make(chan string, 1),
+		done:     make(chan struct{}, 1),
 	}
 }
 
@@ -269,6 +321,9 @@ func (mk1 *Mk1) hw_is_ok(hi vnet.Hi) bool {
 	if !hw.IsProvisioned() {
 		return false
 	}
+	if !ifClassesPublished.has(mk1.hwIfClass(hi)) {
+		return false
+	}
 	return !mk1.unixInterfacesOnly || h.IsUnix()
 }
 
@@ -284,19 +339,30 @@ func (mk1 *Mk1) sw_if_add_del(v *vnet.Vnet, si vnet.Si, isDel bool) error {
 
 func (mk1 *Mk1) sw_if_admin_up_down(v *vnet.Vnet, si vnet.Si, isUp bool) error {
 	if mk1.sw_is_ok(si) {
-		mk1.poller.pubch <- fmt.Sprint(vnet.SiName{V: v, Si: si}, ".admin: ",
-			parse.Enable(isUp))
+		ifname := vnet.SiName{V: v, Si: si}.String()
+		admin := fmt.Sprint(parse.Enable(isUp))
+		mk1.hwIfConfig(ifname).admin = admin
+		mk1.poller.pubq.send(fmt.Sprint(ifname, ".admin: ", admin))
 	}
 	return nil
 }
 
 func (mk1 *Mk1) publish_link(hi vnet.Hi, isUp bool) {
-	mk1.poller.pubch <- fmt.Sprint(hi.Name(&mk1.vnet), ".link: ",
-		parse.Enable(isUp))
+	ifname := hi.Name(&mk1.vnet)
+	entry := mk1.hwIfConfig(ifname)
+	link := fmt.Sprint(parse.Enable(isUp))
+	entry.link = link
+	mk1.poller.pubq.send(fmt.Sprint(ifname, ".link: ", link))
+	mk1.poller.pubq.send(fmt.Sprint(ifname, ".link-loopback: ",
+		entry.linkLoopback()))
 }
 
 func (mk1 *Mk1) hw_if_add_del(v *vnet.Vnet, hi vnet.Hi, isDel bool) error {
 	mk1.hw_if_link_up_down(v, hi, false)
+	if !isDel {
+		// as re-provisioned
+		mk1.hw_if_provision(v, hi, true)
+	}
 	return nil
 }
 
@@ -312,6 +378,10 @@ func (mk1 *Mk1) hw_if_link_up_down(v *vnet.Vnet, hi vnet.Hi, isUp bool) error {
 			xeth.Carrier(index, flag)
 		}
 		mk1.publish_link(hi, isUp)
+		if ifClassesSpeedSync.has(mk1.hwIfClass(hi)) {
+			mk1.syncSpeed(hi)
+			mk1.pubAutoneg(hi)
+		}
 	}
 	return nil
 }
@@ -408,35 +478,56 @@ func (*Mk1) parseFibConfig(v *vnet.Vnet) (err error) {
 
 func (mk1 *Mk1) pubHwIfConfig() {
 	v := &mk1.vnet
-	if mk1.prevHwIfConfig == nil {
-		mk1.prevHwIfConfig = make(map[string]*hwIfConfig)
-	}
 	v.ForeachHwIf(mk1.unixInterfacesOnly, func(hi vnet.Hi) {
 		h := v.HwIf(hi)
 		ifname := hi.Name(v)
 		speed := h.Speed().String()
 		media := h.Media()
-		entry, found := mk1.prevHwIfConfig[ifname]
-		if !found {
-			entry = new(hwIfConfig)
-			mk1.prevHwIfConfig[ifname] = entry
-		}
+		entry := mk1.hwIfConfig(ifname)
 		if speed != mk1.prevHwIfConfig[ifname].speed {
 			s := fmt.Sprint(ifname, ".speed: ", speed)
 			mk1.prevHwIfConfig[ifname].speed = speed
-			mk1.poller.pubch <- s
+			mk1.poller.pubq.send(s)
 		}
 		if media != mk1.prevHwIfConfig[ifname].media {
 			s := fmt.Sprint(ifname, ".media: ", media)
 			mk1.prevHwIfConfig[ifname].media = media
-			mk1.poller.pubch <- s
+			mk1.poller.pubq.send(s)
+		}
+		if entry.loopback == "" {
+			entry.loopback = "none"
+			mk1.poller.pubq.send(fmt.Sprint(ifname, ".loopback: ",
+				entry.loopback))
+		}
+		if autoneg := fmt.Sprint(parse.Enable(h.Speed() == 0)); autoneg != entry.autoneg {
+			if entry.autoneg == "" {
+				mk1.poller.pubq.send(fmt.Sprint(ifname, ".advertise: ",
+					entry.advertise))
+			}
+			s := fmt.Sprint(ifname, ".autoneg: ", autoneg)
+			entry.autoneg = autoneg
+			mk1.poller.pubq.send(s)
+		}
+		if ifClassesSpeedSync.has(mk1.hwIfClass(hi)) {
+			mk1.pubAutoneg(hi)
+		}
+		mk1.pubPortVid(ifname, entry)
+		if mtu := fmt.Sprint(h.MaxPacketSize()); mtu != entry.mtu {
+			s := fmt.Sprint(ifname, ".mtu: ", mtu)
+			entry.mtu = mtu
+			mk1.poller.pubq.send(s)
+		}
+		if class := mk1.hwIfClass(hi).String(); class != entry.class {
+			s := fmt.Sprint(ifname, ".class: ", class)
+			entry.class = class
+			mk1.poller.pubq.send(s)
 		}
 		if h, ok := v.HwIfer(hi).(ethernet.HwInterfacer); ok {
 			fec := h.GetInterface().ErrorCorrectionType.String()
 			if fec != mk1.prevHwIfConfig[ifname].fec {
 				s := fmt.Sprint(ifname, ".fec: ", fec)
 				mk1.prevHwIfConfig[ifname].fec = fec
-				mk1.poller.pubch <- s
+				mk1.poller.pubq.send(s)
 			}
 		}
 	})
@@ -447,14 +538,29 @@ func (mk1 *Mk1) set(key, value string, isReadyEvent bool) (err error) {
 	e.key = key
 	e.value = value
 	e.isReadyEvent = isReadyEvent
+	e.state = eventPending
 	mk1.vnet.SignalEvent(e)
 	if isReadyEvent {
 		return
 	}
+	timer := time.NewTimer(rpcTimeout)
+	defer timer.Stop()
+	select {
+	case <-e.done:
+	case <-timer.C:
+		if atomic.CompareAndSwapInt32(&e.state, eventPending,
+			eventAbandoned) {
+			// EventAction returns the event to the pool unapplied.
+			return fmt.Errorf("%s: timeout after %v", key, rpcTimeout)
+		}
+		// claimed, so it's being applied; wait to publish it
+		<-e.done
+	}
 	if err = <-e.err; err == nil {
 		newValue := <-e.newValue
-		mk1.poller.pubch <- fmt.Sprint(e.key, ": ", newValue)
+		mk1.poller.pubq.send(fmt.Sprint(key, ": ", newValue))
 	}
+	e.put()
 	return
 }
 
@@ -525,56 +631,41 @@ func (*Mk1) getDefaultLanes(port, subport uint) (lanes uint) {
 	return
 }
 
-func (mk1 *Mk1) gopublish() {
-	for s := range mk1.poller.pubch {
-		mk1.pub.Print("vnet.", s)
-	}
-}
-
+// Like gopublish, block for the next record then write everything else
+// queued before flushing a batching sink. Sinks replaced by hf-sink or
+// kafka-broker are closed here rather than on the event loop.
 func (mk1 *Mk1) gopublishHf() {
-	topic := "hf-counters"
-	for s := range mk1.fastPoller.pubch {
-		_ = s
-		_ = topic
-		/* FIXME
-		mk1.producer.ProduceChannel() <- &kafka.Message{
-			TopicPartition: kafka.TopicPartition{
-				Topic:     &topic,
-				Partition: kafka.PartitionAny,
-			},
-			Value: []byte(s),
+	s := &mk1.hfSinker
+	ch := mk1.fastPoller.pubch
+	for {
+		var r *hfRecord
+		select {
+		case <-s.retire:
+			s.closeRetired()
+			continue
+		case x, opened := <-ch:
+			if !opened {
+				return
+			}
+			r = x
 		}
-		mk1.fastPoller.msgCount++
-		*/
-	}
-}
-
-func (mk1 *Mk1) initProducer(broker string) {
-	/* FIXME
-	var err error
-	if mk1.producer != nil {
-		mk1.producer.Close()
-	}
-	mk1.producer, err = kafka.NewProducer(&kafka.ConfigMap{
-		"bootstrap.servers": broker,
-	})
-	if err != nil {
-		fmt.Errorf("error while creating producer: %v", err)
-	} else {
-		go func() {
-			for e := range i.producer.Events() {
-				switch ev := e.(type) {
-				case *kafka.Message:
-					m := ev
-					if m.TopicPartition.Error != nil {
-						fmt.Errorf("Delivery of msg to topic %s [%d] at offset %v failed: %v \n",
-							*m.TopicPartition.Topic, m.TopicPartition.Partition, m.TopicPartition.Offset, m.TopicPartition.Error)
-					}
-				default:
-					fmt.Printf("Ignored event: %s\n", ev)
+		sink := s.get()
+		if sink == nil {
+			continue
+		}
+		s.write(sink, r)
+	drain:
+		for n := 1; n < hfBatchRecords; n++ {
+			select {
+			case r, opened := <-ch:
+				if !opened {
+					break drain
 				}
+				s.write(sink, r)
+			default:
+				break drain
 			}
-		}()
+		}
+		s.flush(sink)
 	}
-	*/
 }
@@ -0,0 +1,242 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+	"unsafe"
+
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/xeth"
+)
+
+// MTU range of front panel ports.
+const (
+	minMtu = 68
+	maxMtu = 9216
+)
+
+// Set vnet's max packet size, as its "set hw IF mtu" does; neither vnet
+// nor the fe1 driver has another MTU or frame size setting.
+func (mk1 *Mk1) setHwMtu(hi vnet.Hi, mtu uint) error {
+	if mtu < minMtu || mtu > maxMtu {
+		return fmt.Errorf("mtu %d out of range %d-%d", mtu, minMtu, maxMtu)
+	}
+	return mk1.vnet.HwIf(hi).SetMaxPacketSize(mtu)
+}
+
+// Set the hardware MTU then, off the event loop, that of the xeth
+// netdev. Should the kernel refuse, the hardware follows it back.
+func (mk1 *Mk1) setMtu(hi vnet.Hi, mtu uint) error {
+	if err := mk1.setHwMtu(hi, mtu); err != nil {
+		return err
+	}
+	ifname := hi.Name(&mk1.vnet)
+	if xethif := xeth.Interface.Named(ifname); xethif != nil {
+		go mk1.setKernelMtu(ifname, xethif.Ifinfo.Index, mtu)
+	}
+	return nil
+}
+
+func (mk1 *Mk1) setKernelMtu(ifname string, ifindex int32, mtu uint) {
+	err := rtnlSetMtu(ifindex, mtu)
+	if err == nil {
+		return
+	}
+	dbgVnetd.Log(ifname, "mtu", mtu, err)
+	if itf, err := net.InterfaceByName(ifname); err == nil {
+		mk1.vnet.SignalEvent(&linkMtuEvent{
+			mk1:    mk1,
+			ifname: ifname,
+			mtu:    uint(itf.MTU),
+		})
+	}
+}
+
+// Kernel MTU of a netdev, e.g. from "ip link set xeth1 mtu 9000", to
+// apply to the hardware of the same name.
+type linkMtuEvent struct {
+	vnet.Event
+	mk1    *Mk1
+	ifname string
+	mtu    uint
+}
+
+func (e *linkMtuEvent) String() string {
+	return fmt.Sprintf("link %s mtu %d", e.ifname, e.mtu)
+}
+
+func (e *linkMtuEvent) EventAction() {
+	v := &e.mk1.vnet
+	hi, found := v.HwIfByName(e.ifname)
+	if !found || e.mtu == v.HwIf(hi).MaxPacketSize() {
+		return
+	}
+	if _, found = vnet.Ports.GetPortByName(e.ifname); !found {
+		return
+	}
+	if err := e.mk1.setHwMtu(hi, e.mtu); err != nil {
+		dbgVnetd.Log(e, err)
+		return
+	}
+	c := e.mk1.hwIfConfig(e.ifname)
+	c.mtu = fmt.Sprint(e.mtu)
+	e.mk1.poller.pubq.send(fmt.Sprint(e.ifname, ".mtu: ", c.mtu))
+}
+
+// Follow kernel MTUs through rtnetlink link notifications, beginning
+// with a dump of all links.
+func (mk1 *Mk1) gomtu() {
+	fd, err := rtnlOpen(1 << (syscall.RTNLGRP_LINK - 1))
+	if err != nil {
+		dbgVnetd.Log("mtu", err)
+		return
+	}
+	defer syscall.Close(fd)
+	var ifi syscall.IfInfomsg
+	err = rtnlSend(fd, syscall.RTM_GETLINK, syscall.NLM_F_DUMP, &ifi, nil)
+	if err != nil {
+		dbgVnetd.Log("mtu", err)
+		return
+	}
+	buf := make([]byte, 1<<16)
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err == syscall.EINTR || err == syscall.ENOBUFS {
+			continue
+		}
+		if err != nil {
+			dbgVnetd.Log("mtu", err)
+			return
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			continue
+		}
+		for i := range msgs {
+			if msgs[i].Header.Type != syscall.RTM_NEWLINK {
+				continue
+			}
+			ifname, mtu, found := rtnlLinkMtu(&msgs[i])
+			if found {
+				mk1.vnet.SignalEvent(&linkMtuEvent{
+					mk1:    mk1,
+					ifname: ifname,
+					mtu:    mtu,
+				})
+			}
+		}
+	}
+}
+
+func rtnlOpen(groups uint32) (int, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK,
+		syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return -1, err
+	}
+	err = syscall.Bind(fd, &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: groups,
+	})
+	if err != nil {
+		syscall.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+// Send an ifinfomsg request followed by attrs.
+func rtnlSend(fd int, msgType, flags uint16, ifi *syscall.IfInfomsg,
+	attrs []byte) error {
+	n := syscall.NLMSG_HDRLEN + syscall.SizeofIfInfomsg + len(attrs)
+	b := make([]byte, n)
+	h := (*syscall.NlMsghdr)(unsafe.Pointer(&b[0]))
+	h.Len = uint32(n)
+	h.Type = msgType
+	h.Flags = syscall.NLM_F_REQUEST | flags
+	h.Seq = 1
+	*(*syscall.IfInfomsg)(unsafe.Pointer(&b[syscall.NLMSG_HDRLEN])) = *ifi
+	copy(b[syscall.NLMSG_HDRLEN+syscall.SizeofIfInfomsg:], attrs)
+	return syscall.Sendto(fd, b, 0,
+		&syscall.SockaddrNetlink{Family: syscall.AF_NETLINK})
+}
+
+// Netlink attribute padded to 4 bytes.
+func rtnlAttr(attrType uint16, value []byte) []byte {
+	n := syscall.SizeofRtAttr + len(value)
+	b := make([]byte, (n+3)&^3)
+	a := (*syscall.RtAttr)(unsafe.Pointer(&b[0]))
+	a.Len = uint16(n)
+	a.Type = attrType
+	copy(b[syscall.SizeofRtAttr:], value)
+	return b
+}
+
+// Netlink attribute of a native uint32.
+func rtnlAttrUint32(attrType uint16, v uint32) []byte {
+	return rtnlAttr(attrType, (*[4]byte)(unsafe.Pointer(&v))[:])
+}
+
+func rtnlSetMtu(ifindex int32, mtu uint) error {
+	fd, err := rtnlOpen(0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+	ifi := syscall.IfInfomsg{Family: syscall.AF_UNSPEC, Index: ifindex}
+	err = rtnlSend(fd, syscall.RTM_NEWLINK, syscall.NLM_F_ACK, &ifi,
+		rtnlAttrUint32(syscall.IFLA_MTU, uint32(mtu)))
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 4096)
+	n, _, err := syscall.Recvfrom(fd, buf, 0)
+	if err != nil {
+		return err
+	}
+	msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+	if err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		if m.Header.Type == syscall.NLMSG_ERROR && len(m.Data) >= 4 {
+			if errno := *(*int32)(unsafe.Pointer(&m.Data[0])); errno != 0 {
+				return syscall.Errno(-errno)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("rtnetlink: no ack")
+}
+
+// Name and MTU of an RTM_NEWLINK message.
+func rtnlLinkMtu(m *syscall.NetlinkMessage) (ifname string, mtu uint,
+	found bool) {
+	attrs, err := syscall.ParseNetlinkRouteAttr(m)
+	if err != nil {
+		return
+	}
+	var hasMtu bool
+	for _, a := range attrs {
+		switch a.Attr.Type {
+		case syscall.IFLA_IFNAME:
+			if n := len(a.Value); n > 0 && a.Value[n-1] == 0 {
+				ifname = string(a.Value[:n-1])
+			} else {
+				ifname = string(a.Value)
+			}
+		case syscall.IFLA_MTU:
+			if len(a.Value) >= 4 {
+				mtu = uint(*(*uint32)(unsafe.Pointer(&a.Value[0])))
+				hasMtu = true
+			}
+		}
+	}
+	found = ifname != "" && hasMtu
+	return
+}
@@ -0,0 +1,81 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"net"
+	"syscall"
+	"testing"
+)
+
+// Dump the links and find each's MTU as gomtu would.
+func TestRtnlLinkMtu(t *testing.T) {
+	fd, err := rtnlOpen(0)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer syscall.Close(fd)
+	var ifi syscall.IfInfomsg
+	err = rtnlSend(fd, syscall.RTM_GETLINK, syscall.NLM_F_DUMP, &ifi, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mtus := make(map[string]uint)
+	buf := make([]byte, 1<<16)
+dump:
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range msgs {
+			switch msgs[i].Header.Type {
+			case syscall.NLMSG_DONE:
+				break dump
+			case syscall.RTM_NEWLINK:
+				if ifname, mtu, found := rtnlLinkMtu(&msgs[i]); found {
+					mtus[ifname] = mtu
+				}
+			}
+		}
+	}
+	itfs, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, itf := range itfs {
+		if mtu, found := mtus[itf.Name]; !found || mtu != uint(itf.MTU) {
+			t.Errorf("%s: mtu %d, %v; want %d", itf.Name, mtu, found,
+				itf.MTU)
+		}
+	}
+}
+
+func TestRtnlAttrUint32(t *testing.T) {
+	m := syscall.NetlinkMessage{
+		Header: syscall.NlMsghdr{Type: syscall.RTM_NEWLINK},
+		Data:   make([]byte, syscall.SizeofIfInfomsg),
+	}
+	m.Data = append(m.Data, rtnlAttrUint32(syscall.IFLA_MTU, 9000)...)
+	m.Data = append(m.Data,
+		rtnlAttr(syscall.IFLA_IFNAME, []byte("xeth1\x00"))...)
+	ifname, mtu, found := rtnlLinkMtu(&m)
+	if !found || ifname != "xeth1" || mtu != 9000 {
+		t.Errorf("rtnlLinkMtu() = %q, %d, %v", ifname, mtu, found)
+	}
+}
+
+func TestSetHwMtuRange(t *testing.T) {
+	mk1 := new(Mk1)
+	for _, mtu := range []uint{0, minMtu - 1, maxMtu + 1} {
+		if err := mk1.setHwMtu(0, mtu); err == nil {
+			t.Errorf("mtu %d accepted", mtu)
+		}
+	}
+}
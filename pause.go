@@ -0,0 +1,51 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/platinasystems/vnet"
+)
+
+// IEEE 802.3x pause and 802.1Qbb pfc are refused after validation;
+// neither vnet, xeth nor the fe1 driver has a flow-control setting.
+
+// "IF.pause" values, the directions in which pause frames are honored
+// and sent.
+var pauseModes = map[string]bool{
+	"off":  true,
+	"rx":   true,
+	"tx":   true,
+	"both": true,
+}
+
+func (mk1 *Mk1) setPause(hi vnet.Hi, mode string) error {
+	if !pauseModes[mode] {
+		return fmt.Errorf("%s: expected rx, tx, both or off", mode)
+	}
+	return fmt.Errorf("pause not supported by vnet or fe1")
+}
+
+// Parse a priority bitmap, bit N enabling priority N, e.g. "0x18" for
+// priorities 3 and 4, or "off".
+func parsePfc(s string) (uint8, error) {
+	if s == "off" {
+		return 0, nil
+	}
+	u, err := strconv.ParseUint(s, 0, 8)
+	if err != nil {
+		return 0, fmt.Errorf("%s: expected priority bitmap", s)
+	}
+	return uint8(u), nil
+}
+
+func (mk1 *Mk1) setPfc(hi vnet.Hi, s string) error {
+	if _, err := parsePfc(s); err != nil {
+		return err
+	}
+	return fmt.Errorf("pfc not supported by vnet or fe1")
+}
@@ -0,0 +1,34 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import "testing"
+
+func TestParsePfc(t *testing.T) {
+	for _, x := range []struct {
+		in  string
+		out uint8
+		ok  bool
+	}{
+		{"off", 0, true},
+		{"0", 0, true},
+		{"0x18", 0x18, true},
+		{"0xff", 0xff, true},
+		{"255", 0xff, true},
+		{"0x100", 0, false},
+		{"3,4", 0, false},
+		{"", 0, false},
+	} {
+		priorities, err := parsePfc(x.in)
+		if (err == nil) != x.ok {
+			t.Errorf("parsePfc(%q): %v", x.in, err)
+			continue
+		}
+		if x.ok && priorities != x.out {
+			t.Errorf("parsePfc(%q) = %#x, want %#x", x.in,
+				priorities, x.out)
+		}
+	}
+}
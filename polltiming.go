@@ -0,0 +1,77 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Upper bounds of the poll duration histogram buckets.
+var pollDurationBuckets = []time.Duration{
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// Self timing of a poller.
+type pollTiming struct {
+	// When the current cycle should have started.
+	due      time.Time
+	lag      time.Duration
+	duration time.Duration
+	overruns uint64
+	// Cumulative counts of cycles no longer than each bucket's bound;
+	// the last counts all cycles.
+	histogram []uint64
+}
+
+func (t *pollTiming) begin(start time.Time) {
+	if t.due.IsZero() {
+		t.due = start
+		t.histogram = make([]uint64, len(pollDurationBuckets)+1)
+	}
+	t.lag = start.Sub(t.due)
+}
+
+// Account the cycle that began at start and return the delay until the
+// next. An overrun skips the missed cycles instead of piling them up.
+func (t *pollTiming) end(start, stop time.Time, interval time.Duration) time.Duration {
+	t.duration = stop.Sub(start)
+	for i, le := range pollDurationBuckets {
+		if t.duration <= le {
+			t.histogram[i]++
+		}
+	}
+	t.histogram[len(pollDurationBuckets)]++
+	next := t.due.Add(interval)
+	if !next.After(stop) {
+		t.overruns++
+		missed := stop.Sub(next)/interval + 1
+		next = next.Add(missed * interval)
+	}
+	t.due = next
+	return next.Sub(stop)
+}
+
+// Publish timing as PREFIX.duration-usec, etc.
+func (p *ifStatsPoller) pubTiming(prefix string, t *pollTiming) {
+	p.pubq.send(fmt.Sprint(prefix, ".duration-usec: ",
+		t.duration/time.Microsecond))
+	p.pubq.send(fmt.Sprint(prefix, ".lag-usec: ", t.lag/time.Microsecond))
+	p.pubq.send(fmt.Sprint(prefix, ".overruns: ", t.overruns))
+	for i, le := range pollDurationBuckets {
+		p.pubq.send(fmt.Sprint(prefix, ".duration.le-",
+			le/time.Millisecond, "ms: ", t.histogram[i]))
+	}
+	p.pubq.send(fmt.Sprint(prefix, ".duration.le-inf: ",
+		t.histogram[len(pollDurationBuckets)]))
+}
@@ -0,0 +1,197 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Most publications that gopublish takes from the queue per batch.
+const pubBatchLines = 1024
+
+// Publication queue that never blocks the sender. Once the channel is
+// full, publications coalesce by key keeping only the latest value until
+// gopublish catches up; beyond chanDepth distinct keys they're dropped.
+type pubQueue struct {
+	ch chan string
+	mu sync.Mutex
+	// Coalesced publications by key, in order of first arrival.
+	pending   map[string]string
+	order     []string
+	coalesced uint64
+	dropped   uint64
+}
+
+func (q *pubQueue) init(depth int) {
+	q.ch = make(chan string, depth)
+	q.pending = make(map[string]string)
+}
+
+func (q *pubQueue) close() { close(q.ch) }
+
+// Length of channel and coalesced publications.
+func (q *pubQueue) len() (int, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.ch), len(q.pending)
+}
+
+// Publish "KEY: VALUE"
+func (q *pubQueue) send(s string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	// Once coalescing, keep at it so an older pending value can't
+	// overwrite a newer one sent through the channel.
+	if len(q.pending) == 0 {
+		select {
+		case q.ch <- s:
+			return
+		default:
+		}
+	}
+	key := s
+	if i := strings.Index(s, ": "); i >= 0 {
+		key = s[:i]
+	}
+	if _, found := q.pending[key]; found {
+		q.coalesced++
+	} else if len(q.pending) >= cap(q.ch) {
+		q.dropped++
+		return
+	} else {
+		q.order = append(q.order, key)
+	}
+	q.pending[key] = s
+}
+
+// Take the coalesced publications.
+func (q *pubQueue) take() (ss []string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 {
+		return
+	}
+	ss = make([]string, 0, len(q.order))
+	for _, key := range q.order {
+		ss = append(ss, q.pending[key])
+	}
+	q.pending = make(map[string]string)
+	q.order = q.order[:0]
+	return
+}
+
+func (q *pubQueue) counts() (coalesced, dropped uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.coalesced, q.dropped
+}
+
+type pubStats struct {
+	batches    uint64
+	lines      uint64
+	lastBatch  uint64
+	maxBatch   uint64
+	lastFlush  int64 // nanoseconds
+	maxFlush   int64
+	flushError uint64
+}
+
+// Block for the next publication then drain everything else queued into
+// the same batch; coalesced publications follow the channel's.
+func (mk1 *Mk1) gopublish() {
+	q := &mk1.poller.pubq
+	batch := make([]string, 0, pubBatchLines)
+	for s := range q.ch {
+		batch = append(batch[:0], s)
+	drain:
+		for len(batch) < pubBatchLines {
+			select {
+			case s, opened := <-q.ch:
+				if !opened {
+					break drain
+				}
+				batch = append(batch, s)
+			default:
+				break drain
+			}
+		}
+		mk1.flushPub(batch)
+		if len(q.ch) > 0 {
+			continue
+		}
+		for pending := q.take(); len(pending) > 0; {
+			n := len(pending)
+			if n > pubBatchLines {
+				n = pubBatchLines
+			}
+			mk1.flushPub(pending[:n])
+			pending = pending[n:]
+		}
+	}
+}
+
+func (mk1 *Mk1) flushPub(batch []string) {
+	st := &mk1.pubStats
+	t := time.Now()
+	errs := writePub(mk1.pub, batch)
+	for _, s := range batch {
+		mk1.subscribers.publish(t, s)
+	}
+	dt := int64(time.Since(t))
+	n := uint64(len(batch))
+	atomic.AddUint64(&st.flushError, errs)
+	atomic.AddUint64(&st.batches, 1)
+	atomic.AddUint64(&st.lines, n)
+	atomic.StoreUint64(&st.lastBatch, n)
+	if n > atomic.LoadUint64(&st.maxBatch) {
+		atomic.StoreUint64(&st.maxBatch, n)
+	}
+	atomic.StoreInt64(&st.lastFlush, dt)
+	if dt > atomic.LoadInt64(&st.maxFlush) {
+		atomic.StoreInt64(&st.maxFlush, dt)
+	}
+}
+
+// Write each "vnet.KEY: VALUE" of a batch as its own publisher datagram,
+// that being what redisd reads as a publication, and return the number
+// that failed.
+func writePub(w io.Writer, batch []string) (errs uint64) {
+	buf := make([]byte, 0, 256)
+	for _, s := range batch {
+		buf = append(append(buf[:0], "vnet."...), s...)
+		if _, err := w.Write(buf); err != nil {
+			errs++
+		}
+	}
+	return
+}
+
+func (mk1 *Mk1) pubPubStats() {
+	st := &mk1.pubStats
+	q := &mk1.poller.pubq
+	q.send(fmt.Sprint("poll.publish.batches: ", atomic.LoadUint64(&st.batches)))
+	q.send(fmt.Sprint("poll.publish.lines: ", atomic.LoadUint64(&st.lines)))
+	q.send(fmt.Sprint("poll.publish.batch-size: ",
+		atomic.LoadUint64(&st.lastBatch)))
+	q.send(fmt.Sprint("poll.publish.max-batch-size: ",
+		atomic.LoadUint64(&st.maxBatch)))
+	q.send(fmt.Sprint("poll.publish.flush-usec: ",
+		atomic.LoadInt64(&st.lastFlush)/int64(time.Microsecond)))
+	q.send(fmt.Sprint("poll.publish.max-flush-usec: ",
+		atomic.LoadInt64(&st.maxFlush)/int64(time.Microsecond)))
+	q.send(fmt.Sprint("poll.publish.errors: ",
+		atomic.LoadUint64(&st.flushError)))
+	coalesced, dropped := q.counts()
+	q.send(fmt.Sprint("poll.coalesced: ", coalesced))
+	q.send(fmt.Sprint("poll.dropped: ", dropped))
+	nsubs, dropped := mk1.subscribers.counts()
+	q.send(fmt.Sprint("poll.publish.subscribers: ", nsubs))
+	q.send(fmt.Sprint("poll.publish.subscriber-dropped: ", dropped))
+}
@@ -0,0 +1,93 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPubQueueCoalescing(t *testing.T) {
+	var q pubQueue
+	q.init(2)
+	for _, s := range []string{
+		"a: 1",
+		"b: 1",
+		// channel full, coalesced from here on
+		"c: 1",
+		"a: 2",
+		"c: 2",
+		// pending at capacity
+		"d: 1",
+		"a: 3",
+	} {
+		q.send(s)
+	}
+	if chlen, pendlen := q.len(); chlen != 2 || pendlen != 2 {
+		t.Errorf("len() = %d, %d; want 2, 2", chlen, pendlen)
+	}
+	if coalesced, dropped := q.counts(); coalesced != 2 || dropped != 1 {
+		t.Errorf("counts() = %d, %d; want 2, 1", coalesced, dropped)
+	}
+	ch := []string{<-q.ch, <-q.ch}
+	if got := strings.Join(ch, ","); got != "a: 1,b: 1" {
+		t.Errorf("channel %q", got)
+	}
+	// still coalescing while pending so an older "a" can't overtake
+	q.send("a: 4")
+	if len(q.ch) != 0 {
+		t.Error("sent through the channel while coalescing")
+	}
+	want := "c: 2,a: 4"
+	if got := strings.Join(q.take(), ","); got != want {
+		t.Errorf("take() = %q, want %q", got, want)
+	}
+	if ss := q.take(); ss != nil {
+		t.Errorf("second take() = %q", ss)
+	}
+	q.send("e: 1")
+	if len(q.ch) != 1 {
+		t.Error("not back to the channel once drained")
+	}
+}
+
+func TestPubQueueKeyless(t *testing.T) {
+	var q pubQueue
+	q.init(1)
+	q.send("x")
+	q.send("ready")
+	q.send("ready")
+	if got := strings.Join(q.take(), ","); got != "ready" {
+		t.Errorf("take() = %q", got)
+	}
+}
+
+// Datagrams written, failing those with the given prefix.
+type testPubWriter struct {
+	datagrams []string
+	fail      string
+}
+
+func (w *testPubWriter) Write(b []byte) (int, error) {
+	s := string(b)
+	w.datagrams = append(w.datagrams, s)
+	if w.fail != "" && strings.HasPrefix(s, w.fail) {
+		return 0, errors.New("refused")
+	}
+	return len(b), nil
+}
+
+func TestWritePub(t *testing.T) {
+	w := &testPubWriter{fail: "vnet.b"}
+	errs := writePub(w, []string{"a: 1", "b: 2", "xeth1.link: true"})
+	want := []string{"vnet.a: 1", "vnet.b: 2", "vnet.xeth1.link: true"}
+	if got := strings.Join(w.datagrams, "|"); got != strings.Join(want, "|") {
+		t.Errorf("datagrams %q, want %q", w.datagrams, want)
+	}
+	if errs != 1 {
+		t.Errorf("%d errors, want 1", errs)
+	}
+}
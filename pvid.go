@@ -0,0 +1,63 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/xeth"
+)
+
+// A port's vid is the xeth driver's, which tags the port's punted frames
+// with it and resends it with every IFINFO; retagging only vnet and fe1
+// would strand the netdev until then. As xeth has no message to retag,
+// a change is refused after being checked.
+func (mk1 *Mk1) setPortVid(hi vnet.Hi, vid uint16) error {
+	ifname := hi.Name(&mk1.vnet)
+	if err := checkPortVid(ifname, vid); err != nil {
+		return err
+	}
+	if entry, _ := vnet.Ports.GetPortByName(ifname); entry.PortVid == vid {
+		return nil
+	}
+	return fmt.Errorf("pvid not supported by xeth")
+}
+
+// A vid must be unique among the ports punted to the same meth.
+func checkPortVid(ifname string, vid uint16) error {
+	if vid < 1 || vid > 4094 {
+		return fmt.Errorf("pvid %d out of range 1-4094", vid)
+	}
+	entry, found := vnet.Ports.GetPortByName(ifname)
+	if !found || entry.Devtype != xeth.XETH_DEVTYPE_XETH_PORT {
+		return fmt.Errorf("%s: not a provisioned port", ifname)
+	}
+	var collision string
+	vnet.Ports.Foreach(func(name string, pe *vnet.PortEntry) {
+		if name != ifname &&
+			pe.Devtype == xeth.XETH_DEVTYPE_XETH_PORT &&
+			pe.PuntIndex == entry.PuntIndex && pe.PortVid == vid {
+			collision = name
+		}
+	})
+	if collision != "" {
+		return fmt.Errorf("pvid %d in use by %s on meth-%d",
+			vid, collision, entry.PuntIndex)
+	}
+	return nil
+}
+
+// Publish IF.pvid of provisioned ports as it changes.
+func (mk1 *Mk1) pubPortVid(ifname string, c *hwIfConfig) {
+	entry, found := vnet.Ports.GetPortByName(ifname)
+	if !found || entry.Devtype != xeth.XETH_DEVTYPE_XETH_PORT {
+		return
+	}
+	if pvid := fmt.Sprint(entry.PortVid); pvid != c.pvid {
+		c.pvid = pvid
+		mk1.poller.pubq.send(fmt.Sprint(ifname, ".pvid: ", pvid))
+	}
+}
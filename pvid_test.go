@@ -0,0 +1,50 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/platinasystems/vnet"
+	"github.com/platinasystems/xeth"
+)
+
+func TestCheckPortVid(t *testing.T) {
+	for _, x := range []struct {
+		name      string
+		vid       uint16
+		puntIndex uint8
+	}{
+		{"xeth1", 3000, 0},
+		{"xeth2", 3001, 0},
+		{"xeth3", 3002, 1},
+	} {
+		pe := vnet.Ports.SetPort(x.name)
+		pe.Devtype = xeth.XETH_DEVTYPE_XETH_PORT
+		pe.PortVid = x.vid
+		pe.PuntIndex = x.puntIndex
+		defer vnet.Ports.UnsetPort(x.name)
+	}
+	for _, x := range []struct {
+		ifname string
+		vid    uint16
+		ok     bool
+	}{
+		{"xeth1", 0, false},
+		{"xeth1", 4095, false},
+		{"xeth9", 3100, false},
+		{"xeth1", 3000, true},
+		{"xeth1", 3100, true},
+		// xeth2 has it on the same meth
+		{"xeth1", 3001, false},
+		// xeth3 has it on the other meth
+		{"xeth1", 3002, true},
+		{"xeth3", 3000, true},
+	} {
+		if err := checkPortVid(x.ifname, x.vid); (err == nil) != x.ok {
+			t.Errorf("checkPortVid(%s, %d): %v", x.ifname, x.vid, err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/platinasystems/vnet"
+)
+
+// Derived rate published alongside a raw counter.
+type counterRate struct {
+	name  string
+	scale float64
+	// utilization of link speed; only for bit rates
+	utilization string
+}
+
+var counterRates = map[string]counterRate{
+	"rx-bytes":   {"rx-bps", 8, "rx-utilization"},
+	"tx-bytes":   {"tx-bps", 8, "tx-utilization"},
+	"rx-packets": {"rx-pps", 1, ""},
+	"tx-packets": {"tx-pps", 1, ""},
+}
+
+// rate key, if any, for the given translated counter name
+func rateOf(counter string) (r counterRate, found bool) {
+	if r, found = counterRates[counter]; !found &&
+		strings.Contains(counter, "error") {
+		r = counterRate{name: counter + "-per-sec", scale: 1}
+		found = true
+	}
+	return
+}
+
+// Speed for utilization; that negotiated once link is up as an autoneg
+// port's configured speed is 0.
+func (mk1 *Mk1) linkSpeed(hi vnet.Hi) vnet.Bandwidth {
+	h := mk1.vnet.HwIf(hi)
+	if h.IsLinkUp() {
+		return mk1.vnet.HwIfer(hi).GetHwInterfaceFinalSpeed()
+	}
+	return h.Speed()
+}
+
+// Publish the rates derived from the last two polls of counter.
+// The speed, if known, is that of linkSpeed.
+// The counter is polled every interval seconds.
+func (p *ifStatsPoller) pubRate(psi *ifStatsPollerInterface, counter string,
+	speed vnet.Bandwidth, interval float64) {
+	r, found := rateOf(xCounter(counter))
+	if !found || !p.filter.allows(counter) {
+		return
+	}
+	rate := psi.lastValues[counter].rate * r.scale
+	p.publishRate(psi, r.name, rate)
+	if _, found := counterRates[xCounter(counter)]; found {
+		p.addWindowSample(psi, r.name, psi.lastValues[counter].time,
+			rate, interval)
+	}
+	if r.utilization != "" && speed != 0 {
+		p.publishRate(psi, r.utilization, 100*rate/float64(speed))
+	}
+}
+
+func (p *ifStatsPoller) publishRate(psi *ifStatsPollerInterface, name string,
+	rate float64) {
+	if psi.lastRates == nil {
+		psi.lastRates = make(map[string]string)
+	}
+	s := fmt.Sprintf("%.2f", rate)
+	if v, found := psi.lastRates[name]; found && v == s {
+		return
+	}
+	psi.lastRates[name] = s
+	p.pubq.send(fmt.Sprintf("%s.%s: %s", psi.name, name, s))
+}
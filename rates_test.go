@@ -0,0 +1,27 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestRateOf(t *testing.T) {
+	for _, x := range []struct {
+		counter, name string
+		found         bool
+	}{
+		{"rx-bytes", "rx-bps", true},
+		{"tx-packets", "tx-pps", true},
+		{"rx-crc-error", "rx-crc-error-per-sec", true},
+		{"rx-multicast-packets", "", false},
+	} {
+		r, found := rateOf(x.counter)
+		if found != x.found || r.name != x.name {
+			t.Errorf("rateOf(%q) = %q, %v; want %q, %v",
+				x.counter, r.name, found, x.name, x.found)
+		}
+	}
+}
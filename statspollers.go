@@ -7,7 +7,10 @@ package main
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/platinasystems/vnet"
@@ -16,35 +19,122 @@ import (
 
 // One per each hw/sw interface from vnet.
 type ifStatsPollerInterface struct {
-	lastValues   map[string]uint64
+	name         string
+	lastValues   map[string]ifCounter
+	lastRates    map[string]string
 	hfLastValues map[string]uint64
+	// Counter discontinuities since start.
+	resets, wraps uint64
+	lastReset     time.Time
+	discontinuity bool
+	// Values at last "clear counters"; published values are relative
+	// to these and the absolute values move to the raw. prefix.
+	baseline map[string]uint64
+	// Groups, nil for the ungrouped, yet to republish since the clear.
+	republish map[*counterGroup]bool
+	// Raised alarms by translated counter name.
+	alarms map[string]bool
+	// Recent rx/tx bit and packet rates by rate name.
+	windows map[string]*rateWindow
+	// Linux VLAN or bridge netdev of a sw interface; 0 for none.
+	netdev int32
 }
 
-func (i *ifStatsPollerInterface) update(counter string, value uint64) (updated bool) {
+// Last polled value of a counter with the time it was read.
+type ifCounter struct {
+	value uint64
+	time  time.Time
+	// per second change over the real interval between the last two polls
+	rate float64
+	// set if the counter was reset or wrapped since the previous poll
+	reset, wrapped bool
+}
+
+// Delta of a monotonic counter from prev to value. A decrease is either
+// a 64-bit wrap, if the distance forward through zero is plausible, or
+// a reset (hardware clear or port re-provision) after which the counter
+// restarted from zero.
+func counterDelta(prev, value uint64) (delta uint64, reset, wrapped bool) {
+	delta = value - prev
+	if value < prev {
+		if delta < 1<<63 {
+			wrapped = true
+		} else {
+			delta, reset = value, true
+		}
+	}
+	return
+}
+
+func (i *ifStatsPollerInterface) update(counter string, value uint64, now time.Time) (updated bool) {
 	if i.lastValues == nil {
-		i.lastValues = make(map[string]uint64)
+		i.lastValues = make(map[string]ifCounter)
 	}
-	if v, ok := i.lastValues[counter]; ok {
-		if updated = v != value; updated {
-			i.lastValues[counter] = value
+	c, ok := i.lastValues[counter]
+	if ok {
+		var delta uint64
+		updated = c.value != value
+		delta, c.reset, c.wrapped = counterDelta(c.value, value)
+		c.rate = 0
+		if dt := now.Sub(c.time).Seconds(); dt > 0 {
+			c.rate = float64(delta) / dt
+		}
+		i.discontinuity = i.discontinuity || c.reset || c.wrapped
+		if c.reset {
+			i.resets++
+			i.lastReset = now
+			// the hardware cleared it for us
+			delete(i.baseline, counter)
+		} else if c.wrapped {
+			i.wraps++
 		}
 	} else {
 		updated = true
-		i.lastValues[counter] = value
 	}
+	c.value = value
+	c.time = now
+	i.lastValues[counter] = c
 	return
 }
+
+// Snapshot current values as the baseline of relative counters that
+// each of groups republishes with its next poll.
+func (i *ifStatsPollerInterface) clear(groups []*counterGroup) {
+	i.baseline = make(map[string]uint64)
+	for counter, c := range i.lastValues {
+		i.baseline[counter] = c.value
+	}
+	i.republish = map[*counterGroup]bool{nil: true}
+	for _, g := range groups {
+		i.republish[g] = true
+	}
+}
+
+func (i *ifStatsPollerInterface) relative(counter string, value uint64) uint64 {
+	if b, found := i.baseline[counter]; found && value >= b {
+		return value - b
+	}
+	return value
+}
+
+// Raw names of fast poller counters that are published as deltas; the
+// rest are levels published as is.
+var hfMonotonic = regexp.MustCompile(`packets|bytes|collisions`)
+
 func (i *ifStatsPollerInterface) updateHf(counter string, value uint64) (delta uint64, updated bool) {
 	if i.hfLastValues == nil {
 		i.hfLastValues = make(map[string]uint64)
 	}
-	portregex := regexp.MustCompile(`(packets|bytes) *`)
 	if v, ok := i.hfLastValues[counter]; ok {
 		if updated = v != value; updated {
 			i.hfLastValues[counter] = value
-			if portregex.MatchString(counter) {
-				if value > v {
-					delta = value - v
+			if hfMonotonic.MatchString(counter) {
+				var reset, wrapped bool
+				delta, reset, wrapped = counterDelta(v, value)
+				if reset {
+					i.resets++
+				} else if wrapped {
+					i.wraps++
 				}
 			} else {
 				delta = value
@@ -57,51 +147,107 @@ func (i *ifStatsPollerInterface) updateHf(counter string, value uint64) (delta u
 	return
 }
 
+// Publish reset and wrap accounting of interfaces with a discontinuity
+// in this poll so consumers can tell it apart from real traffic.
+func (p *ifStatsPoller) pubDiscontinuities(ifs ifStatsPollerInterfaceVec) {
+	for i := range ifs {
+		psi := &ifs[i]
+		if !psi.discontinuity {
+			continue
+		}
+		psi.discontinuity = false
+		p.pubq.send(fmt.Sprint(psi.name, ".counters.reset-count: ", psi.resets))
+		p.pubq.send(fmt.Sprint(psi.name, ".counters.wrap-count: ", psi.wraps))
+		if !psi.lastReset.IsZero() {
+			p.pubq.send(fmt.Sprint(psi.name, ".counters.last-reset: ",
+				psi.lastReset.Format(time.RFC3339Nano)))
+		}
+	}
+}
+
 //go:generate gentemplate -d Package=main -id ifStatsPollerInterface -d VecType=ifStatsPollerInterfaceVec -d Type=ifStatsPollerInterface github.com/platinasystems/elib/vec.tmpl
 
 type ifStatsPoller struct {
 	vnet.Event
-	mk1          *Mk1
+	mk1 *Mk1
+	// mu guards the interface vectors against metrics scrapes.
+	mu           sync.Mutex
 	sequence     uint
 	hwInterfaces ifStatsPollerInterfaceVec
 	swInterfaces ifStatsPollerInterfaceVec
 	pollInterval float64 // pollInterval in seconds
-	pubch        chan string
+	pubq         pubQueue
+	alarmRules   alarmRules
+	timing       pollTiming
+	groups       counterGroups
+	filter       *counterFilter
+	// Publish vnet.IF.json each poll.
+	json bool
 }
 
 func (p *ifStatsPoller) publish(name, counter string, value uint64) {
-	p.pubch <- fmt.Sprintf("%s.%s: %d", name, counter, value)
+	p.pubq.send(fmt.Sprintf("%s.%s: %d", name, counter, value))
 }
 
-func (p *ifStatsPoller) addEvent(dt float64) {
-	p.mk1.vnet.SignalEventAfter(p, dt)
+// Clear counters of the named interface, or all if name is empty.
+func (p *ifStatsPoller) clearCounters(name string) (found bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, ifs := range []ifStatsPollerInterfaceVec{
+		p.hwInterfaces,
+		p.swInterfaces,
+	} {
+		for i := range ifs {
+			if psi := &ifs[i]; name == "" || psi.name == name {
+				psi.clear(p.groups.list)
+				found = true
+			}
+		}
+	}
+	return
 }
 
-func (p *ifStatsPoller) String() string {
-	return fmt.Sprintf("redis stats poller sequence %d", p.sequence)
+// Sweep of the counters of group g, nil for the ungrouped, that are
+// polled every interval seconds.
+type pollSweep struct {
+	start    time.Time
+	g        *counterGroup
+	interval float64
+	// Include zero counters, as with the first poll of the group.
+	includeZero bool
 }
 
-func (p *ifStatsPoller) EventAction() {
-	// Schedule next event in 5 seconds; do before fetching counters so that time interval is accurate.
-	p.addEvent(p.pollInterval)
-
-	start := time.Now()
-	s := fmt.Sprint("poll.start.time: ", start.Format(time.StampMilli))
-	p.pubch <- s
-	s = fmt.Sprint("poll.start.channel-length: ", len(p.pubch))
-	p.pubch <- s
-
-	p.mk1.pubHwIfConfig()
-
-	// Publish all sw/hw interface counters even with zero values for first poll.
-	// This was all possible counters have valid values in redis.
-	// Otherwise only publish to redis when counter values change.
-	includeZeroCounters := p.sequence == 0
+// Poll the counters of group g, nil for those in no group, with their
+// own influx timestamp. Discontinuities and windows are published with
+// the ungrouped.
+func (p *ifStatsPoller) pollCounters(start time.Time, g *counterGroup) {
+	sweep := pollSweep{
+		start:       start,
+		g:           g,
+		interval:    p.pollInterval,
+		includeZero: p.sequence == 0,
+	}
+	if g != nil {
+		sweep.interval = g.pollInterval
+		sweep.includeZero = g.sequence == 0
+	}
+	influx := p.mk1.influx.enabled()
 
-	pubcount := func(ifname, counter string, value uint64) {
+	pubcount := func(psi *ifStatsPollerInterface, counter string, raw uint64) {
+		if !p.filter.allows(counter) {
+			return
+		}
+		ifname := psi.name
+		value := psi.relative(counter, raw)
 		counter = xCounter(counter)
+		if influx {
+			p.mk1.influx.add(ifname, counter, raw)
+		}
+		if psi.baseline != nil {
+			p.publish("raw."+ifname, counter, raw)
+		}
 		entry := xeth.Interface.Named(ifname)
-		if value != 0 && entry != nil &&
+		if (value != 0 || psi.baseline != nil) && entry != nil &&
 			entry.DevType == xeth.XETH_DEVTYPE_XETH_PORT {
 			if _, found := vnet.Ports.Load(ifname); found {
 				xethif := xeth.Interface.Named(ifname)
@@ -109,52 +255,187 @@ func (p *ifStatsPoller) EventAction() {
 				xeth.SetStat(ifindex, counter, value)
 			}
 
+		} else if psi.netdev != 0 {
+			if stat, found := swLinkStat(counter); found {
+				xeth.SetStat(psi.netdev, stat, value)
+			}
 		}
 		p.publish(ifname, counter, value)
 	}
-	p.mk1.vnet.ForeachHwIfCounter(includeZeroCounters,
+	hwClasses := make(map[vnet.Hi]ifClass)
+	hwSpeeds := make(map[vnet.Hi]vnet.Bandwidth)
+	swClasses := make(map[vnet.Si]ifClass)
+	netdevs := vlanNetdevs()
+	p.mu.Lock()
+	p.mk1.vnet.ForeachHwIfCounter(sweep.includeZero,
 		p.mk1.unixInterfacesOnly,
 		func(hi vnet.Hi, counter string, value uint64) {
+			if p.groupOf(counter) != g {
+				return
+			}
+			class, found := hwClasses[hi]
+			if !found {
+				class = p.mk1.hwIfClass(hi)
+				hwClasses[hi] = class
+			}
+			if !ifClassesPolled.has(class) {
+				return
+			}
+			speed, found := hwSpeeds[hi]
+			if !found {
+				speed = p.mk1.linkSpeed(hi)
+				hwSpeeds[hi] = speed
+			}
+			ifname := hi.Name(&p.mk1.vnet)
 			p.hwInterfaces.Validate(uint(hi))
-			if p.hwInterfaces[hi].update(counter, value) && true {
-				pubcount(hi.Name(&p.mk1.vnet), counter, value)
+			psi := &p.hwInterfaces[hi]
+			psi.name = ifname
+			if psi.update(counter, value, start) || psi.republish[g] {
+				pubcount(psi, counter, value)
 			}
+			p.pubRate(psi, counter, speed, sweep.interval)
+			p.checkAlarm(psi, counter, start)
 		})
 
-	p.mk1.vnet.ForeachSwIfCounter(includeZeroCounters,
+	p.mk1.vnet.ForeachSwIfCounter(sweep.includeZero,
 		func(si vnet.Si, siName, counter string, value uint64) {
+			if p.groupOf(counter) != g {
+				return
+			}
+			class, found := swClasses[si]
+			if !found {
+				class = p.mk1.swIfClass(si)
+				swClasses[si] = class
+			}
+			if !ifClassesPolled.has(class) {
+				return
+			}
 			p.swInterfaces.Validate(uint(si))
-			if p.swInterfaces[si].update(counter, value) && true {
-				pubcount(siName, counter, value)
+			psi := &p.swInterfaces[si]
+			psi.name = siName
+			psi.netdev = netdevs[si]
+			if psi.update(counter, value, start) || psi.republish[g] {
+				pubcount(psi, counter, value)
 			}
+			p.pubRate(psi, counter, 0, sweep.interval)
+			p.checkAlarm(psi, counter, start)
 		})
+	for i := range p.hwInterfaces {
+		if psi := &p.hwInterfaces[i]; psi.name != "" {
+			speed := p.mk1.linkSpeed(vnet.Hi(i))
+			p.pollZeroed(psi, &sweep, speed, pubcount)
+		}
+	}
+	for i := range p.swInterfaces {
+		if psi := &p.swInterfaces[i]; psi.name != "" {
+			p.pollZeroed(psi, &sweep, 0, pubcount)
+		}
+	}
+	if g == nil {
+		p.pubDiscontinuities(p.hwInterfaces)
+		p.pubDiscontinuities(p.swInterfaces)
+		p.pubWindows(p.hwInterfaces, start)
+		p.pubWindows(p.swInterfaces, start)
+	}
+	p.mu.Unlock()
 
-	stop := time.Now()
-	p.pubch <- fmt.Sprint("poll.stop.time: ", stop.Format(time.StampMilli))
-	p.pubch <- fmt.Sprint("poll.stop.channel-length: ", len(p.pubch))
+	if influx {
+		p.mk1.influx.flush(start)
+		if g == nil {
+			p.pubq.send(fmt.Sprint("influx.errors: ",
+				atomic.LoadUint64(&p.mk1.influx.errors)))
+		}
+	}
+}
 
-	p.mk1.vnet.ForeachHwIf(false, func(hi vnet.Hi) {
-		h := p.mk1.vnet.HwIfer(hi)
-		hw := p.mk1.vnet.HwIf(hi)
-		// FIXME how to filter these in a better way?
-		if strings.Contains(hw.Name(), "fe1-") ||
-			strings.Contains(hw.Name(), "pg") ||
-			strings.Contains(hw.Name(), "meth") {
+// Poll as zero the counters of psi that the sweep left out, i.e. those
+// that fell to zero, so that their value, rate and alarm don't stick.
+// Then the sweep's group is through republishing psi.
+func (p *ifStatsPoller) pollZeroed(psi *ifStatsPollerInterface,
+	sweep *pollSweep, speed vnet.Bandwidth,
+	pubcount func(*ifStatsPollerInterface, string, uint64)) {
+	for counter, c := range psi.lastValues {
+		if !c.time.Before(sweep.start) {
+			continue
+		}
+		if p.groupOf(counter) != sweep.g {
+			continue
+		}
+		if psi.update(counter, 0, sweep.start) || psi.republish[sweep.g] {
+			pubcount(psi, counter, 0)
+		}
+		p.pubRate(psi, counter, speed, sweep.interval)
+		p.checkAlarm(psi, counter, sweep.start)
+	}
+	delete(psi.republish, sweep.g)
+}
+
+// Linux VLAN and bridge netdevs learned through xeth IFINFO indexed by
+// their vnet sw interface.
+func vlanNetdevs() map[vnet.Si]int32 {
+	netdevs := make(map[vnet.Si]int32)
+	vnet.Ports.ForeachSiByIndex(func(ifindex int32, si vnet.Si) {
+		entry := xeth.Interface.Indexed(ifindex)
+		if entry == nil {
 			return
 		}
+		switch entry.DevType {
+		case xeth.XETH_DEVTYPE_LINUX_VLAN,
+			xeth.XETH_DEVTYPE_LINUX_VLAN_BRIDGE_PORT,
+			xeth.XETH_DEVTYPE_LINUX_BRIDGE:
+			netdevs[si] = ifindex
+		}
+	})
+	return netdevs
+}
 
-		if hw.IsLinkUp() {
-			sp := h.GetHwInterfaceFinalSpeed()
-			// Send speed message to driver so ethtool can see it
-			xethif := xeth.Interface.Named(hw.Name())
-			ifindex := xethif.Ifinfo.Index
-			xeth.Speed(int(ifindex), uint64(sp/1e6))
-			if false {
-				fmt.Println("FinalSpeed:", hw.Name(), ifindex, sp, uint64(sp/1e6))
-			}
+func (p *ifStatsPoller) addEvent(dt float64) {
+	p.mk1.vnet.SignalEventAfter(p, dt)
+}
+
+func (p *ifStatsPoller) String() string {
+	return fmt.Sprintf("redis stats poller sequence %d", p.sequence)
+}
+
+func (p *ifStatsPoller) EventAction() {
+	start := time.Now()
+	p.timing.begin(start)
+	s := fmt.Sprint("poll.start.time: ", start.Format(time.StampMilli))
+	p.pubq.send(s)
+	chlen, pendlen := p.pubq.len()
+	p.pubq.send(fmt.Sprint("poll.start.channel-length: ", chlen))
+	p.pubq.send(fmt.Sprint("poll.start.pending-length: ", pendlen))
+
+	p.mk1.pubHwIfConfig()
+	p.mk1.pubHf()
+
+	// Publish all sw/hw interface counters even with zero values for first poll.
+	// This was all possible counters have valid values in redis.
+	// Otherwise only publish to redis when counter values change.
+	p.pollCounters(start, nil)
+	if p.json {
+		p.pubIfDocs(start)
+	}
+	stop := time.Now()
+	p.pubq.send(fmt.Sprint("poll.stop.time: ", stop.Format(time.StampMilli)))
+	chlen, pendlen = p.pubq.len()
+	p.pubq.send(fmt.Sprint("poll.stop.channel-length: ", chlen))
+	p.pubq.send(fmt.Sprint("poll.stop.pending-length: ", pendlen))
+	p.mk1.pubPubStats()
+
+	p.mk1.vnet.ForeachHwIf(false, func(hi vnet.Hi) {
+		if ifClassesSpeedSync.has(p.mk1.hwIfClass(hi)) {
+			p.mk1.syncSpeed(hi)
 		}
 	})
 
+	// Schedule next event relative to when this one was due so that
+	// the interval stays accurate and overruns don't pile up.
+	interval := time.Duration(p.pollInterval * float64(time.Second))
+	dt := p.timing.end(start, time.Now(), interval)
+	p.addEvent(dt.Seconds())
+	p.pubTiming("poll", &p.timing)
+
 	p.sequence++
 }
 
@@ -165,15 +446,122 @@ type fastIfStatsPoller struct {
 	hwInterfaces ifStatsPollerInterfaceVec
 	swInterfaces ifStatsPollerInterfaceVec
 	pollInterval float64 // pollInterval in milliseconds
-	pubch        chan string
-	msgCount     uint64
+	pubch        chan *hfRecord
 	hostname     string
+	// Interfaces and counters of configHfCounters; nil for all.
+	interfaces hfSelection
+	counters   hfSelection
+	// Column order of hfRecord.Values
+	header   []string
+	overruns uint64
+	dropped  uint64
+}
+
+// Comma separated names, or "all".
+type hfSelection map[string]struct{}
+
+func newHfSelection(s string) hfSelection {
+	if s == "all" {
+		return nil
+	}
+	sel := make(hfSelection)
+	for _, name := range strings.Split(s, ",") {
+		if name != "" {
+			sel[name] = struct{}{}
+		}
+	}
+	return sel
+}
+
+func (sel hfSelection) has(name string) bool {
+	if sel == nil {
+		return true
+	}
+	_, found := sel[name]
+	return found
 }
 
-func (p *fastIfStatsPoller) publish(data map[string]string) {
+func (sel hfSelection) String() string {
+	if sel == nil {
+		return "all"
+	}
+	names := make([]string, 0, len(sel))
+	for name := range sel {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func (p *fastIfStatsPoller) publish(data map[string][]string) {
+	msec := time.Now().UnixNano() / 1000000
 	for k, v := range data {
-		p.pubch <- fmt.Sprintf("%s,%d,%s,%s", p.hostname, time.Now().UnixNano()/1000000, k, v)
+		select {
+		case p.pubch <- &hfRecord{
+			Host:   p.hostname,
+			Msec:   msec,
+			Ifname: k,
+			Values: strings.Join(v, ","),
+		}:
+		default:
+			// never block the event loop on a slow sink
+			p.dropped++
+		}
+	}
+}
+
+// Program vnet's high frequency counter map, as its config-port-counter
+// command does, with the selected counters of the selected interfaces so
+// that ForeachHighFreqHwIfCounter reads no others. Until either is set,
+// the map is left to that command.
+func (p *fastIfStatsPoller) configHfCounters() {
+	v := &p.mk1.vnet
+	hf := make(map[vnet.Hi][]int)
+	v.ForeachHwIf(p.mk1.unixInterfacesOnly, func(hi vnet.Hi) {
+		if !ifClassesPolled.has(p.mk1.hwIfClass(hi)) ||
+			!p.interfaces.has(hi.Name(v)) {
+			return
+		}
+		nm := v.HwIfer(hi).GetHwInterfaceCounterNames()
+		for k, name := range nm.Single {
+			if p.counters.has(xCounter(name)) {
+				hf[hi] = append(hf[hi], k)
+			}
+		}
+	})
+	v.GetIfThread(0).HfCounters = hf
+}
+
+// Columns of the counters in vnet's high frequency map; interfaces
+// needn't have the same counters or have them in the same order.
+func (p *fastIfStatsPoller) hfColumns() ([]string, map[string]int) {
+	v := &p.mk1.vnet
+	var names []string
+	for hi, ks := range v.GetIfThread(0).HfCounters {
+		nm := v.HwIfer(hi).GetHwInterfaceCounterNames()
+		for _, k := range ks {
+			if k < len(nm.Single) {
+				names = append(names, xCounter(nm.Single[k]))
+			}
+		}
+	}
+	return newHfColumns(names)
+}
+
+// Sorted, unique names and the column of each.
+func newHfColumns(names []string) (header []string, cols map[string]int) {
+	cols = make(map[string]int)
+	for _, name := range names {
+		if _, found := cols[name]; !found {
+			cols[name] = 0
+			header = append(header, name)
+		}
 	}
+	sort.Strings(header)
+	for i, name := range header {
+		cols[name] = i
+	}
+	return
 }
 
 func (p *fastIfStatsPoller) addEvent(dt float64) {
@@ -181,27 +569,44 @@ func (p *fastIfStatsPoller) addEvent(dt float64) {
 }
 
 func (p *fastIfStatsPoller) String() string {
-	return fmt.Sprintf("redis stats poller sequence %d", p.sequence)
+	return fmt.Sprintf("hf stats poller sequence %d", p.sequence)
 }
 
 func (p *fastIfStatsPoller) EventAction() {
-	// Schedule next event in 200 milliseconds; do before fetching counters so that time interval is accurate.
-	//p.addEvent(p.pollInterval / 1000)
+	// Schedule next event in pollInterval milliseconds; do before
+	// fetching counters so that time interval is accurate.
+	start := time.Now()
+	p.addEvent(p.pollInterval / 1000)
+	defer func() { p.sequence++ }()
 
-	// Publish all sw/hw interface counters even with zero values for first poll.
-	// This was all possible counters have valid values in redis.
-	// Otherwise only publish to redis when counter values change.
-	var c = make(map[string]string)
+	if !p.mk1.hfSinker.active() {
+		return
+	}
+
+	// Include zero counters so every row has its columns.
+	header, cols := p.hfColumns()
+	c := make(map[string][]string)
 	p.mk1.vnet.ForeachHighFreqHwIfCounter(true,
 		p.mk1.unixInterfacesOnly,
-		func(hi vnet.Hi, counter string, value uint64) {
+		func(hi vnet.Hi, raw string, value uint64) {
+			col, found := cols[xCounter(raw)]
+			if !found {
+				return
+			}
 			ifname := hi.Name(&p.mk1.vnet)
+			row := c[ifname]
+			if row == nil {
+				row = make([]string, len(header))
+				c[ifname] = row
+			}
 			p.hwInterfaces.Validate(uint(hi))
-			delta, _ := p.hwInterfaces[hi].updateHf(counter, value)
-			c[ifname] = c[ifname] + fmt.Sprint(delta) + ","
+			delta, _ := p.hwInterfaces[hi].updateHf(raw, value)
+			row[col] = fmt.Sprint(delta)
 		})
-	//if p.mk1.producer != nil{
-	//	p.publish(c)
-	//}
-	p.sequence++
+	p.header = header
+	p.publish(c)
+
+	if dt := time.Since(start); dt.Seconds()*1000 > p.pollInterval {
+		p.overruns++
+	}
 }
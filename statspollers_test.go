@@ -0,0 +1,112 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCounterDelta(t *testing.T) {
+	const max = ^uint64(0)
+	for _, x := range []struct {
+		prev, value    uint64
+		delta          uint64
+		reset, wrapped bool
+	}{
+		{0, 0, 0, false, false},
+		{10, 25, 15, false, false},
+		{max - 4, 5, 10, false, true},
+		{max, 0, 1, false, true},
+		{1000, 3, 3, true, false},
+		{1 << 62, 0, 0, true, false},
+	} {
+		delta, reset, wrapped := counterDelta(x.prev, x.value)
+		if delta != x.delta || reset != x.reset || wrapped != x.wrapped {
+			t.Errorf("counterDelta(%d, %d) = %d, %v, %v; want %d, %v, %v",
+				x.prev, x.value, delta, reset, wrapped,
+				x.delta, x.reset, x.wrapped)
+		}
+	}
+}
+
+func TestUpdateDiscontinuity(t *testing.T) {
+	var psi ifStatsPollerInterface
+	t0 := time.Now()
+	psi.update("rx-packets", 100, t0)
+	psi.clear(nil)
+	psi.update("rx-packets", 5, t0.Add(time.Second))
+	if psi.resets != 1 || !psi.discontinuity {
+		t.Errorf("resets %d discontinuity %v after a reset",
+			psi.resets, psi.discontinuity)
+	}
+	if _, found := psi.baseline["rx-packets"]; found {
+		t.Error("baseline kept after a hardware reset")
+	}
+	if got := psi.relative("rx-packets", 5); got != 5 {
+		t.Errorf("relative = %d, want 5", got)
+	}
+	c := psi.lastValues["rx-packets"]
+	if !c.reset || c.rate != 5 {
+		t.Errorf("reset %v rate %g, want true 5", c.reset, c.rate)
+	}
+}
+
+func TestClearRepublish(t *testing.T) {
+	errors, cpu := &counterGroup{name: "errors"}, &counterGroup{name: "cpu"}
+	var psi ifStatsPollerInterface
+	psi.update("rx-packets", 7, time.Now())
+	psi.clear([]*counterGroup{errors, cpu})
+	for _, g := range []*counterGroup{nil, errors, cpu} {
+		if !psi.republish[g] {
+			t.Errorf("group %v not pending republish", g)
+		}
+	}
+	// the ungrouped poll doesn't satisfy the others
+	delete(psi.republish, nil)
+	if !psi.republish[errors] || !psi.republish[cpu] {
+		t.Error("republish of groups lost")
+	}
+	if got := psi.relative("rx-packets", 9); got != 2 {
+		t.Errorf("relative = %d, want 2", got)
+	}
+}
+
+func TestPollZeroed(t *testing.T) {
+	p := &ifStatsPoller{alarmRules: alarmRules{
+		"rx-packets": {Absolute: 5},
+	}}
+	p.pubq.init(64)
+	t0 := time.Now()
+	t1 := t0.Add(time.Second)
+	psi := &ifStatsPollerInterface{name: "xeth1"}
+	psi.update("port-rx-packets", 0, t0)
+	psi.update("port-rx-packets", 10, t1)
+	p.pubRate(psi, "port-rx-packets", 0, 1)
+	p.checkAlarm(psi, "port-rx-packets", t1)
+	if !psi.alarms["rx-packets"] {
+		t.Fatal("alarm not raised")
+	}
+	// not in the next sweep
+	var pubs []string
+	sweep := &pollSweep{
+		start:    t1.Add(time.Second),
+		interval: 1,
+	}
+	p.pollZeroed(psi, sweep, 0,
+		func(psi *ifStatsPollerInterface, counter string, raw uint64) {
+			pubs = append(pubs, fmt.Sprint(counter, "=", raw))
+		})
+	if len(pubs) != 1 || pubs[0] != "port-rx-packets=0" {
+		t.Errorf("published %q", pubs)
+	}
+	if got := psi.lastRates["rx-pps"]; got != "0.00" {
+		t.Errorf("rx-pps = %q, want 0.00", got)
+	}
+	if psi.alarms["rx-packets"] {
+		t.Error("alarm not cleared")
+	}
+}
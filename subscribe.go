@@ -0,0 +1,223 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/platinasystems/atsock"
+)
+
+// Companion stream socket of the "vnetd" rpc server.
+const subscribeSocket = "vnetd-subscribe"
+
+// Most publications buffered for a subscriber; beyond this they're
+// dropped for that subscriber alone.
+const subscriberDepth = 4096
+
+// Subscribers to vnet publications. A client connects to
+// @vnetd-subscribe and writes a line of space or comma separated key
+// patterns, e.g. "xeth*.link *.rx-crc-errors", then reads lines of,
+//
+//	TIME vnet.KEY: VALUE
+//
+// as each matching publication leaves the publication queue. Another
+// line of patterns replaces the previous; an empty line matches nothing.
+// A line with a malformed pattern is answered with,
+//
+//	TIME subscribe.error: ERROR
+//
+// and leaves the previous patterns in place.
+// After a subscriber has fallen behind it's sent,
+//
+//	TIME subscribe.dropped: COUNT
+//
+// before the next publication.
+type subscribers struct {
+	ln net.Listener
+	mu sync.Mutex
+	// Number of subscribers with patterns; publish is a noop without.
+	active int32
+	list   []*subscriber
+	// Total publications dropped for slow subscribers.
+	dropped uint64
+}
+
+type subscriber struct {
+	conn     net.Conn
+	ch       chan string
+	patterns []string
+	dropped  uint64
+}
+
+func (subs *subscribers) listen(name string) (err error) {
+	subs.ln, err = atsock.Listen(name)
+	if err == nil {
+		go subs.accept()
+	}
+	return
+}
+
+func (subs *subscribers) close() {
+	subs.ln.Close()
+	subs.mu.Lock()
+	defer subs.mu.Unlock()
+	for _, sub := range subs.list {
+		sub.conn.Close()
+	}
+}
+
+func (subs *subscribers) accept() {
+	for {
+		conn, err := subs.ln.Accept()
+		if err != nil {
+			break
+		}
+		sub := subs.add(conn)
+		go subs.gowrite(sub)
+		go subs.goread(sub)
+	}
+}
+
+func (subs *subscribers) add(conn net.Conn) *subscriber {
+	sub := &subscriber{
+		conn: conn,
+		ch:   make(chan string, subscriberDepth),
+	}
+	subs.mu.Lock()
+	defer subs.mu.Unlock()
+	subs.list = append(subs.list, sub)
+	return sub
+}
+
+// Read pattern lines until the subscriber hangs up.
+func (subs *subscribers) goread(sub *subscriber) {
+	scanner := bufio.NewScanner(sub.conn)
+	for scanner.Scan() {
+		patterns, err := parsePatterns(scanner.Text())
+		if err != nil {
+			// gowrite drains ch until remove, below, closes it
+			sub.ch <- fmt.Sprint(time.Now().Format(time.RFC3339Nano),
+				" subscribe.error: ", err, "\n")
+			continue
+		}
+		subs.setPatterns(sub, patterns)
+	}
+	subs.remove(sub)
+}
+
+// Space or comma separated key patterns, with or without the vnet.
+// prefix, in the syntax of path.Match.
+func parsePatterns(line string) ([]string, error) {
+	patterns := strings.FieldsFunc(line, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+	for i, pat := range patterns {
+		patterns[i] = strings.TrimPrefix(pat, "vnet.")
+		if _, err := path.Match(patterns[i], ""); err != nil {
+			return nil, fmt.Errorf("%s: %v", pat, err)
+		}
+	}
+	return patterns, nil
+}
+
+func (subs *subscribers) setPatterns(sub *subscriber, patterns []string) {
+	subs.mu.Lock()
+	defer subs.mu.Unlock()
+	if len(sub.patterns) == 0 && len(patterns) > 0 {
+		atomic.AddInt32(&subs.active, 1)
+	} else if len(sub.patterns) > 0 && len(patterns) == 0 {
+		atomic.AddInt32(&subs.active, -1)
+	}
+	sub.patterns = patterns
+}
+
+func (subs *subscribers) gowrite(sub *subscriber) {
+	w := bufio.NewWriter(sub.conn)
+	for s := range sub.ch {
+		if n := atomic.SwapUint64(&sub.dropped, 0); n > 0 {
+			fmt.Fprint(w, time.Now().Format(time.RFC3339Nano),
+				" subscribe.dropped: ", n, "\n")
+		}
+		w.WriteString(s)
+		if len(sub.ch) == 0 {
+			if err := w.Flush(); err != nil {
+				break
+			}
+		}
+	}
+	sub.conn.Close()
+	// drain until removed
+	for range sub.ch {
+	}
+}
+
+func (subs *subscribers) remove(sub *subscriber) {
+	subs.mu.Lock()
+	defer subs.mu.Unlock()
+	for i, x := range subs.list {
+		if x == sub {
+			subs.list = append(subs.list[:i], subs.list[i+1:]...)
+			if len(sub.patterns) > 0 {
+				atomic.AddInt32(&subs.active, -1)
+			}
+			close(sub.ch)
+			break
+		}
+	}
+	sub.conn.Close()
+}
+
+func (sub *subscriber) matches(key string) bool {
+	for _, pat := range sub.patterns {
+		if match, _ := path.Match(pat, key); match {
+			return true
+		}
+	}
+	return false
+}
+
+// Stream the "KEY: VALUE" publication to matching subscribers without
+// blocking on any of them.
+func (subs *subscribers) publish(t time.Time, s string) {
+	if atomic.LoadInt32(&subs.active) == 0 {
+		return
+	}
+	key := s
+	if i := strings.Index(s, ": "); i >= 0 {
+		key = s[:i]
+	}
+	var line string
+	subs.mu.Lock()
+	defer subs.mu.Unlock()
+	for _, sub := range subs.list {
+		if !sub.matches(key) {
+			continue
+		}
+		if line == "" {
+			line = fmt.Sprint(t.Format(time.RFC3339Nano), " vnet.", s,
+				"\n")
+		}
+		select {
+		case sub.ch <- line:
+		default:
+			atomic.AddUint64(&sub.dropped, 1)
+			atomic.AddUint64(&subs.dropped, 1)
+		}
+	}
+}
+
+func (subs *subscribers) counts() (n int, dropped uint64) {
+	subs.mu.Lock()
+	defer subs.mu.Unlock()
+	return len(subs.list), atomic.LoadUint64(&subs.dropped)
+}
@@ -0,0 +1,161 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePatterns(t *testing.T) {
+	for _, x := range []struct {
+		in, out string
+		ok      bool
+	}{
+		{"xeth*.link *.rx-crc-errors", "xeth*.link|*.rx-crc-errors", true},
+		{"vnet.xeth1.*,poll.*", "xeth1.*|poll.*", true},
+		{"", "", true},
+		{"xeth[1-4].link", "xeth[1-4].link", true},
+		{"xeth[.link", "", false},
+		{"ok.* bad\\", "", false},
+	} {
+		patterns, err := parsePatterns(x.in)
+		if (err == nil) != x.ok {
+			t.Errorf("parsePatterns(%q): %v", x.in, err)
+			continue
+		}
+		if got := strings.Join(patterns, "|"); got != x.out {
+			t.Errorf("parsePatterns(%q) = %q, want %q", x.in, got, x.out)
+		}
+	}
+}
+
+func testSubscriber(t *testing.T, subs *subscribers,
+	patterns string) *subscriber {
+	conn, _ := net.Pipe()
+	sub := subs.add(conn)
+	pats, err := parsePatterns(patterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subs.setPatterns(sub, pats)
+	return sub
+}
+
+func TestSubscribersFanOut(t *testing.T) {
+	var subs subscribers
+	links := testSubscriber(t, &subs, "xeth*.link")
+	all := testSubscriber(t, &subs, "*")
+	crc := testSubscriber(t, &subs, "*.rx-crc-errors")
+	now := time.Now()
+	subs.publish(now, "xeth1.link: true")
+	subs.publish(now, "xeth2.rx-crc-errors: 3")
+	for _, x := range []struct {
+		sub  *subscriber
+		want []string
+	}{
+		{links, []string{"vnet.xeth1.link: true"}},
+		{all, []string{"vnet.xeth1.link: true",
+			"vnet.xeth2.rx-crc-errors: 3"}},
+		{crc, []string{"vnet.xeth2.rx-crc-errors: 3"}},
+	} {
+		if n := len(x.sub.ch); n != len(x.want) {
+			t.Errorf("%q got %d, want %d", x.sub.patterns, n,
+				len(x.want))
+			continue
+		}
+		for _, want := range x.want {
+			if got := <-x.sub.ch; !strings.HasSuffix(got, " "+want+"\n") {
+				t.Errorf("%q got %q, want %q", x.sub.patterns, got, want)
+			}
+		}
+	}
+}
+
+func TestSubscribersDropSlow(t *testing.T) {
+	var subs subscribers
+	slow := testSubscriber(t, &subs, "*")
+	fast := testSubscriber(t, &subs, "*")
+	for i := 0; i < subscriberDepth; i++ {
+		slow.ch <- "stale\n"
+	}
+	done := make(chan struct{})
+	go func() {
+		subs.publish(time.Now(), "xeth1.link: true")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked on a full subscriber")
+	}
+	if slow.dropped != 1 {
+		t.Errorf("slow dropped %d, want 1", slow.dropped)
+	}
+	if n, dropped := subs.counts(); n != 2 || dropped != 1 {
+		t.Errorf("counts %d, %d; want 2, 1", n, dropped)
+	}
+	if len(fast.ch) != 1 {
+		t.Errorf("fast has %d, want 1", len(fast.ch))
+	}
+}
+
+func TestSubscriberStream(t *testing.T) {
+	var subs subscribers
+	conn, client := net.Pipe()
+	sub := subs.add(conn)
+	go subs.gowrite(sub)
+	go subs.goread(sub)
+	r := bufio.NewReader(client)
+	readLine := func() string {
+		client.SetReadDeadline(time.Now().Add(time.Second))
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		return line
+	}
+
+	client.Write([]byte("xeth[.link\n"))
+	if line := readLine(); !strings.Contains(line,
+		" subscribe.error: xeth[.link: ") {
+		t.Errorf("malformed pattern answered with %q", line)
+	}
+
+	client.Write([]byte("xeth*.link\n"))
+	// wait for goread to take the patterns
+	for deadline := time.Now().Add(time.Second); ; {
+		subs.mu.Lock()
+		n := len(sub.patterns)
+		subs.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("patterns not set")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	subs.publish(time.Now(), "xeth1.mtu: 9000")
+	subs.publish(time.Now(), "xeth1.link: true")
+	if line := readLine(); !strings.HasSuffix(line,
+		" vnet.xeth1.link: true\n") {
+		t.Errorf("streamed %q", line)
+	}
+
+	client.Close()
+	for deadline := time.Now().Add(time.Second); ; {
+		if n, _ := subs.counts(); n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("subscriber not removed on hang up")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Rolling windows of rate samples published as
+//
+//	IF.RATE.WINDOW.{min,avg,max,p95}
+//
+// e.g. xeth1.rx-bps.5m.p95
+var rateWindows = []struct {
+	name    string
+	seconds float64
+}{
+	{"1m", 60},
+	{"5m", 5 * 60},
+	{"15m", 15 * 60},
+}
+
+func longestRateWindow() float64 {
+	return rateWindows[len(rateWindows)-1].seconds
+}
+
+type rateSample struct {
+	t time.Time
+	v float64
+}
+
+// Ring of the samples of the longest window. Samples are kept and
+// windowed by their poll time, not their count, as polls are rescheduled
+// and the interval may change.
+type rateWindow struct {
+	samples  []rateSample
+	first, n int
+}
+
+// Sized for the longest window at the given poll interval; it grows
+// should polls come faster.
+func newRateWindow(interval float64) *rateWindow {
+	return &rateWindow{
+		samples: make([]rateSample,
+			windowSamples(longestRateWindow(), interval)),
+	}
+}
+
+// i'th oldest sample
+func (w *rateWindow) at(i int) *rateSample {
+	return &w.samples[(w.first+i)%len(w.samples)]
+}
+
+func (w *rateWindow) add(t time.Time, v float64) {
+	for w.n > 0 && t.Sub(w.at(0).t).Seconds() >= longestRateWindow() {
+		w.first = (w.first + 1) % len(w.samples)
+		w.n--
+	}
+	if w.n == len(w.samples) {
+		samples := make([]rateSample, 2*len(w.samples)+1)
+		for i := 0; i < w.n; i++ {
+			samples[i] = *w.at(i)
+		}
+		w.samples, w.first = samples, 0
+	}
+	*w.at(w.n) = rateSample{t, v}
+	w.n++
+}
+
+// Statistics of the samples within the given seconds before t.
+func (w *rateWindow) stats(t time.Time, seconds float64) (min, avg, max,
+	p95 float64) {
+	var v []float64
+	for i := w.n - 1; i >= 0; i-- {
+		s := w.at(i)
+		if t.Sub(s.t).Seconds() >= seconds {
+			break
+		}
+		v = append(v, s.v)
+		avg += s.v
+	}
+	n := len(v)
+	if n == 0 {
+		return
+	}
+	sort.Float64s(v)
+	min, max = v[0], v[n-1]
+	avg /= float64(n)
+	p95 = v[int(math.Ceil(0.95*float64(n)))-1]
+	return
+}
+
+// Samples in a window of the given seconds at the given poll interval.
+func windowSamples(seconds, interval float64) int {
+	return int(math.Ceil(seconds / interval))
+}
+
+// Add a rate sample, polled at t, to its window.
+func (p *ifStatsPoller) addWindowSample(psi *ifStatsPollerInterface,
+	name string, t time.Time, rate, interval float64) {
+	if psi.windows == nil {
+		psi.windows = make(map[string]*rateWindow)
+	}
+	w, found := psi.windows[name]
+	if !found {
+		w = newRateWindow(interval)
+		psi.windows[name] = w
+	}
+	w.add(t, rate)
+}
+
+// Publish the windows ending with the poll at t.
+func (p *ifStatsPoller) pubWindows(ifs ifStatsPollerInterfaceVec,
+	t time.Time) {
+	for i := range ifs {
+		psi := &ifs[i]
+		for name, w := range psi.windows {
+			for _, x := range rateWindows {
+				min, avg, max, p95 := w.stats(t, x.seconds)
+				prefix := name + "." + x.name
+				p.publishRate(psi, prefix+".min", min)
+				p.publishRate(psi, prefix+".avg", avg)
+				p.publishRate(psi, prefix+".max", max)
+				p.publishRate(psi, prefix+".p95", p95)
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright © 2016-2019 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by the GPL-2 license described in the
+// LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// Samples 0, 1, 2, ... every interval seconds from t0, then those at
+// interval2 seconds.
+type windowTest struct {
+	name      string
+	interval  float64
+	n         int
+	interval2 float64
+	n2        int
+	seconds   float64
+	// stats of the window ending with the last sample
+	min, avg, max, p95 float64
+	// samples kept and ring size
+	kept, size int
+}
+
+var t0 = time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func (x *windowTest) run() (*rateWindow, time.Time) {
+	w := newRateWindow(x.interval)
+	t := t0
+	v := 0.0
+	for i := 0; i < x.n+x.n2; i++ {
+		if i > 0 && i < x.n {
+			t = t.Add(time.Duration(x.interval * float64(time.Second)))
+		} else if i > 0 {
+			t = t.Add(time.Duration(x.interval2 * float64(time.Second)))
+		}
+		w.add(t, v)
+		v++
+	}
+	return w, t
+}
+
+func TestRateWindow(t *testing.T) {
+	for _, x := range []windowTest{
+		{
+			name:     "p95 of 1m at 5s",
+			interval: 5, n: 20, seconds: 60,
+			// 12 samples 8..19
+			min: 8, avg: 13.5, max: 19, p95: 19,
+			kept: 20, size: 180,
+		},
+		{
+			name:     "p95 of 100 samples",
+			interval: 1, n: 100, seconds: 100,
+			min: 0, avg: 49.5, max: 99, p95: 94,
+			kept: 100, size: 900,
+		},
+		{
+			name:     "ring wrap",
+			interval: 60, n: 40, seconds: 15 * 60,
+			// the last 15 of 0..39
+			min: 25, avg: 32, max: 39, p95: 39,
+			kept: 15, size: 15,
+		},
+		{
+			name:     "1m after faster polls",
+			interval: 60, n: 15, interval2: 1, n2: 60,
+			seconds: 60,
+			// 1s samples 15..74
+			min: 15, avg: 44.5, max: 74, p95: 71,
+			kept: 74, size: 127,
+		},
+		{
+			name:     "5m across interval change",
+			interval: 60, n: 15, interval2: 1, n2: 60,
+			seconds: 5 * 60,
+			// 60s samples 11..14 are within the last 5m
+			min: 11, avg: 42.5, max: 74, p95: 71,
+			kept: 74, size: 127,
+		},
+		{
+			name:     "gap evicts",
+			interval: 1, n: 10, interval2: 15 * 60, n2: 1,
+			seconds: 15 * 60,
+			min:     10, avg: 10, max: 10, p95: 10,
+			kept: 1, size: 900,
+		},
+	} {
+		w, last := x.run()
+		min, avg, max, p95 := w.stats(last, x.seconds)
+		if min != x.min || max != x.max || p95 != x.p95 ||
+			avg-x.avg > 1e-9 || x.avg-avg > 1e-9 {
+			t.Errorf("%s: min %g avg %g max %g p95 %g; want %g %g %g %g",
+				x.name, min, avg, max, p95, x.min, x.avg, x.max, x.p95)
+		}
+		if w.n != x.kept || len(w.samples) != x.size {
+			t.Errorf("%s: kept %d of %d, want %d of %d",
+				x.name, w.n, len(w.samples), x.kept, x.size)
+		}
+	}
+}
+
+func TestRateWindowEmpty(t *testing.T) {
+	w := newRateWindow(5)
+	if min, avg, max, p95 := w.stats(t0, 60); min != 0 || avg != 0 ||
+		max != 0 || p95 != 0 {
+		t.Errorf("empty window: %g %g %g %g", min, avg, max, p95)
+	}
+	w.add(t0, 7)
+	if _, _, max, _ := w.stats(t0.Add(time.Minute), 60); max != 0 {
+		t.Errorf("stale sample in 1m window: max %g", max)
+	}
+}